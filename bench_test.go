@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//nolint:gochecknoglobals // Read-only benchmark settings.
+var benchResolutions = []image.Point{{320, 200}, {640, 480}, {1280, 720}, {1920, 1080}}
+
+// benchGames runs the benchmark for each embedded map and resolution, with the player at the spawn.
+func benchGames(b *testing.B, fn func(b *testing.B, g *Game)) {
+	b.Helper()
+
+	entries, err := mapData.ReadDir("maps")
+	if err != nil {
+		b.Fatalf("readDir: %s", err)
+	}
+	for _, elem := range entries {
+		buf, err := mapData.ReadFile("maps/" + elem.Name())
+		if err != nil {
+			b.Fatalf("readFile: %s", err)
+		}
+		for _, res := range benchResolutions {
+			lvl, err := parseLevelFile(elem.Name(), buf)
+			if err != nil {
+				b.Fatalf("parseLevelFile: %s", err)
+			}
+			g, err := newHeadlessGame(elem.Name(), lvl, res.X, res.Y)
+			if err != nil {
+				b.Fatalf("newHeadlessGame: %s", err)
+			}
+			b.Run(fmt.Sprintf("%s/%dx%d", elem.Name(), res.X, res.Y), func(b *testing.B) {
+				b.ReportAllocs()
+				fn(b, g)
+			})
+		}
+	}
+}
+
+// benchRays returns the rays of each screen column, ready to run.
+func benchRays(g *Game) []DDA {
+	rays := make([]DDA, g.width)
+	for x := range rays {
+		rays[x] = *newDDA(2*float64(x)/float64(g.width)-1, g.pos, g.dir, g.plane)
+	}
+	return rays
+}
+
+func BenchmarkNewDDA(b *testing.B) {
+	benchGames(b, func(b *testing.B, g *Game) {
+		for i := 0; i < b.N; i++ {
+			for x := 0; x < g.width; x++ {
+				_ = newDDA(2*float64(x)/float64(g.width)-1, g.pos, g.dir, g.plane)
+			}
+		}
+	})
+}
+
+func BenchmarkDDARun(b *testing.B) {
+	benchGames(b, func(b *testing.B, g *Game) {
+		rays := benchRays(g)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for x := range rays {
+				dda := rays[x] // Copy, run changes the state.
+				dda.run(g.world, g.pos)
+			}
+		}
+	})
+}
+
+func BenchmarkFrame(b *testing.B) {
+	benchGames(b, func(b *testing.B, g *Game) {
+		for i := 0; i < b.N; i++ {
+			_ = g.frame()
+		}
+	})
+}
+
+func BenchmarkDrawBackground(b *testing.B) {
+	benchGames(b, func(b *testing.B, g *Game) {
+		img := image.NewRGBA(image.Rect(0, 0, g.width, g.height))
+		rays := benchRays(g)
+		wallXs, drawStarts, drawEnds := make([]float64, len(rays)), make([]int, len(rays)), make([]int, len(rays))
+		focal := g.focalLength()
+		for x := range rays {
+			rays[x].run(g.world, g.pos)
+			wallXs[x], _ = getTexX(g.pos, rays[x].rayDir, rays[x].side, rays[x].perpWallDist)
+			lineHeight := max(1, int(focal/rays[x].perpWallDist))
+			_, drawStarts[x], drawEnds[x] = wallSpan(lineHeight, g.horizon(), g.height, g.eyeZ())
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for x := range rays {
+				g.drawBackground(img, &rays[x], x, wallXs[x], drawStarts[x], drawEnds[x], focal)
+			}
+		}
+	})
+}
+
+// BenchmarkMinimap only measures the CPU side, the draw commands are queued until a graphics driver runs them.
+func BenchmarkMinimap(b *testing.B) {
+	benchGames(b, func(b *testing.B, g *Game) {
+		g.minimapZoom = 16
+		// Set by newGame, the headless game doesn't have it.
+		g.triangleImg = ebiten.NewImage(g.screenSize())
+		g.triangleImg.Fill(color.White)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = g.minimap(g.width/5, g.height/5)
+		}
+	})
+}
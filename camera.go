@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Vertical look and camera height settings.
+const (
+	maxPitch         = 0.5   // Maximum horizon offset, in screen heights.
+	pitchSpeed       = 0.8   // Screen heights per second.
+	mouseSensitivity = 0.002 // Screen heights per pixel.
+
+	eyeHeight   = 0.5 // Standing eye height, the walls being 1 case high.
+	jumpSpeed   = 2.5 // Initial vertical speed of a jump, in cases per second.
+	gravity     = 9.0 // In cases per second squared.
+	crouchDepth = 0.2 // Eye height lost when crouching.
+	crouchSpeed = 1.5 // Cases per second.
+)
+
+// horizon returns the screen row of the horizon, moved by the pitch (y-shearing) and the view effects.
+func (g *Game) horizon() int {
+	_, dy := g.viewOffset()
+	return g.height/2 + int((g.pitch+dy)*float64(g.height))
+}
+
+// eyeZ returns the eye height above the floor.
+func (g *Game) eyeZ() float64 {
+	return min(0.95, max(0.05, eyeHeight+g.jumpZ-g.crouchZ))
+}
+
+// wallSpan returns the screen rows of a wall (or sprite) of the given projected height:
+// its unclamped top and the rows to draw, drawEnd excluded.
+func wallSpan(lineHeight, horizon, height int, eye float64) (top, drawStart, drawEnd int) {
+	top = horizon - int((1-eye)*float64(lineHeight))
+	bottom := horizon + int(eye*float64(lineHeight))
+	return top, min(height, max(0, top)), min(height, max(0, bottom))
+}
+
+// stepCamera updates the pitch and the camera height for a tick.
+func (g *Game) stepCamera(a actions, dt float64) {
+	if a&actLookUp != 0 {
+		g.pitch = min(maxPitch, g.pitch+pitchSpeed*dt)
+	}
+	if a&actLookDown != 0 {
+		g.pitch = max(-maxPitch, g.pitch-pitchSpeed*dt)
+	}
+	if a&actCenterView != 0 {
+		g.pitch = 0
+	}
+
+	// Jump only from the ground.
+	if a&actJump != 0 && g.jumpZ == 0 {
+		g.jumpVel = jumpSpeed
+	}
+	if g.jumpZ > 0 || g.jumpVel > 0 {
+		g.jumpZ += g.jumpVel * dt
+		g.jumpVel -= gravity * dt
+		if g.jumpZ <= 0 {
+			g.jumpZ, g.jumpVel = 0, 0
+		}
+	}
+
+	if a&actCrouch != 0 {
+		g.crouchZ = min(crouchDepth, g.crouchZ+crouchSpeed*dt)
+	} else {
+		g.crouchZ = max(0, g.crouchZ-crouchSpeed*dt)
+	}
+}
+
+// updateMouseLook changes the pitch with the vertical mouse movements, when enabled.
+// The cursor is captured meanwhile.
+func (g *Game) updateMouseLook() {
+	if !g.mouseLook || g.editor.enabled || g.console.open {
+		if ebiten.CursorMode() == ebiten.CursorModeCaptured {
+			ebiten.SetCursorMode(ebiten.CursorModeVisible)
+		}
+		g.cursorY = nil
+		return
+	}
+	ebiten.SetCursorMode(ebiten.CursorModeCaptured)
+	_, y := ebiten.CursorPosition()
+	if g.cursorY != nil {
+		g.pitch = min(maxPitch, max(-maxPitch, g.pitch-float64(y-*g.cursorY)*mouseSensitivity))
+	}
+	g.cursorY = &y
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestJumpCrouch(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	if err := g.step(actJump); err != nil {
+		t.Fatalf("step: %s", err)
+	}
+	peak, ticks := 0.0, 1
+	for ; g.jumpZ > 0 && ticks < 10*tickRate; ticks++ {
+		peak = max(peak, g.jumpZ)
+		// No double jump.
+		if err := g.step(actJump); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	if expect := jumpSpeed * jumpSpeed / (2 * gravity); math.Abs(peak-expect) > 0.05 {
+		t.Errorf("unexpected jump height:\nexpect:\t%f\ngot:\t%f", expect, peak)
+	}
+	if expect := 2 * jumpSpeed / gravity * tickRate; math.Abs(float64(ticks)-expect) > 3 {
+		t.Errorf("unexpected jump duration:\nexpect:\t%f ticks\ngot:\t%d ticks", expect, ticks)
+	}
+	if g.jumpZ != 0 || g.jumpVel != 0 {
+		t.Errorf("should be back on the ground: %f %f", g.jumpZ, g.jumpVel)
+	}
+
+	for i := 0; i < tickRate; i++ {
+		if err := g.step(actCrouch); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	if expect := eyeHeight - crouchDepth; math.Abs(g.eyeZ()-expect) > 1e-9 {
+		t.Errorf("unexpected crouching eye height:\nexpect:\t%f\ngot:\t%f", expect, g.eyeZ())
+	}
+	for i := 0; i < tickRate; i++ {
+		if err := g.step(0); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	if g.eyeZ() != eyeHeight {
+		t.Errorf("should stand up when released: %f", g.eyeZ())
+	}
+}
+
+func TestPitch(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	for i := 0; i < 10*tickRate; i++ {
+		if err := g.step(actLookUp); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	if g.pitch != maxPitch {
+		t.Errorf("the pitch should be clamped: %f", g.pitch)
+	}
+	if err := g.step(actCenterView); err != nil {
+		t.Fatalf("step: %s", err)
+	}
+	if g.pitch != 0 {
+		t.Errorf("the view should be centered: %f", g.pitch)
+	}
+}
+
+func TestShearedFrame(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap(bigMap(8))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	// A 1x1 pillar right in front of the player, at 2.5 cases.
+	world[3][5].wallType = 2
+
+	g := &Game{width: 160, height: 120, world: world, explored: newExploredSet(world), pos: math2.Pt(2.5, 3.5), dir: math2.Pt(1, 0)}
+	g.updatePlane()
+	// Everything is grey, the pillar is colored.
+	for y := range g.texturesCache {
+		for x := range g.texturesCache[y] {
+			g.texturesCache[y][x] = [3]byte{9, 9, 9}
+			g.sideTexturesCache[y][x] = [3]byte{9, 9, 9}
+		}
+		for x := 2 * texSize; x < 3*texSize; x++ {
+			g.texturesCache[y][x] = [3]byte{1, 2, 3}
+		}
+	}
+	lineHeight := int(g.focalLength() / 2.5)
+
+	for _, tc := range []struct {
+		name                  string
+		pitch, jumpZ, crouchZ float64
+	}{
+		{"straight", 0, 0, 0},
+		{"look up", 0.2, 0, 0},
+		{"look down", -0.2, 0, 0},
+		{"jump", 0, 0.2, 0},
+		{"jump look up", 0.1, 0.2, 0},
+		{"crouch", 0, 0, crouchDepth},
+	} {
+		g.pitch, g.jumpZ, g.crouchZ = tc.pitch, tc.jumpZ, tc.crouchZ
+		img, _ := g.frame().(*image.RGBA) // Always RGBA.
+
+		first, last := -1, -1
+		for y := 0; y < g.height; y++ {
+			off := img.PixOffset(g.width/2, y)
+			switch px := img.Pix[off : off+3]; {
+			case px[0] == 1 && px[1] == 2 && px[2] == 3:
+				if first == -1 {
+					first = y
+				}
+				last = y
+			case px[0] == 0 && px[1] == 0 && px[2] == 0:
+				t.Errorf("%s: row %d not drawn", tc.name, y)
+			}
+		}
+		// The eye level of the pillar is on the horizon.
+		horizon := float64(g.height)/2 + tc.pitch*float64(g.height)
+		eye := eyeHeight + tc.jumpZ - tc.crouchZ
+		if expect := horizon - (1-eye)*float64(lineHeight); math.Abs(float64(first)-expect) > 1.5 {
+			t.Errorf("%s: unexpected pillar top:\nexpect:\t%f\ngot:\t%d", tc.name, expect, first)
+		}
+		if expect := horizon + eye*float64(lineHeight); math.Abs(float64(last+1)-expect) > 1.5 {
+			t.Errorf("%s: unexpected pillar bottom:\nexpect:\t%f\ngot:\t%d", tc.name, expect, last)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// campaign is the ordered list of episodes and their levels.
+type campaign struct {
+	episodes []episode
+}
+
+// episode is a named sequence of levels.
+type episode struct {
+	name   string
+	levels []campaignLevel
+}
+
+// campaignLevel is a level of an episode.
+type campaignLevel struct {
+	mapName string // Embedded map name, in maps/.
+	name    string // Displayed name, defaults to the map name.
+	par     uint64 // Par time, in ticks.
+}
+
+// campaignProgress is the position of the player in the campaign and the stats carried between the levels.
+type campaignProgress struct {
+	Episode      int        `json:"episode"`
+	Level        int        `json:"level"`
+	Total        levelStats `json:"total"`        // Sum of the finished levels stats.
+	Intermission bool       `json:"intermission"` // The level is finished, showing its stats.
+}
+
+// parseCampaign parses a campaign file, using the map file directives:
+//
+//	@episode <name>: Starts a new episode. The name is URL query escaped.
+//	@level <map> <par> [name]: Adds a level to the current episode, par time as m:ss.
+//	                           The name is URL query escaped, defaults to the map name.
+func parseCampaign(data []byte) (*campaign, error) {
+	c := &campaign{}
+	for _, d := range parseDirectives(data) {
+		if err := c.applyDirective(d); err != nil {
+			return nil, fmt.Errorf("line %d: %w", d[0].line, err)
+		}
+	}
+	if len(c.episodes) == 0 {
+		return nil, errors.New("no episodes")
+	}
+	for _, e := range c.episodes {
+		if len(e.levels) == 0 {
+			return nil, fmt.Errorf("episode %q has no levels", e.name)
+		}
+	}
+	return c, nil
+}
+
+// applyDirective adds the episode or level from the given directive.
+func (c *campaign) applyDirective(d []mapToken) error {
+	name, args := d[0].text, d[1:]
+	switch name {
+	case "episode":
+		if len(args) != 1 {
+			return fmt.Errorf("episode expects 1 argument, got %d", len(args))
+		}
+		epName, err := url.QueryUnescape(args[0].text)
+		if err != nil {
+			return fmt.Errorf("invalid episode name %q: %w", args[0].text, err)
+		}
+		c.episodes = append(c.episodes, episode{name: epName})
+	case "level":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("level expects 2 or 3 arguments, got %d", len(args))
+		}
+		if len(c.episodes) == 0 {
+			return errors.New("level before the first episode")
+		}
+		if _, err := fs.Stat(mapData, "maps/"+args[0].text); err != nil {
+			return fmt.Errorf("unknown map %q", args[0].text)
+		}
+		par, err := parsePar(args[1].text)
+		if err != nil {
+			return err
+		}
+		lvl := campaignLevel{mapName: args[0].text, name: args[0].text, par: par}
+		if len(args) == 3 {
+			if lvl.name, err = url.QueryUnescape(args[2].text); err != nil {
+				return fmt.Errorf("invalid level name %q: %w", args[2].text, err)
+			}
+		}
+		e := &c.episodes[len(c.episodes)-1]
+		e.levels = append(e.levels, lvl)
+	default:
+		return fmt.Errorf("unknown directive %q", name)
+	}
+	return nil
+}
+
+// parsePar parses a m:ss par time, in ticks.
+func parsePar(text string) (uint64, error) {
+	m, s, ok := strings.Cut(text, ":")
+	minutes, errM := strconv.ParseUint(m, 10, 64)
+	seconds, errS := strconv.ParseUint(s, 10, 64)
+	if !ok || errM != nil || errS != nil || seconds >= 60 {
+		return 0, fmt.Errorf("invalid par time %q, expect m:ss", text)
+	}
+	return (minutes*60 + seconds) * tickRate, nil
+}
+
+// defaultCampaign returns the embedded campaign.
+func defaultCampaign() (*campaign, error) {
+	c, err := parseCampaign(campaignData)
+	if err != nil {
+		return nil, fmt.Errorf("parseCampaign: %w", err)
+	}
+	return c, nil
+}
+
+// currentLevel returns the current level of the campaign.
+func (g *Game) currentLevel() campaignLevel {
+	return g.campaignDef.episodes[g.campaign.Episode].levels[g.campaign.Level]
+}
+
+// startCampaign starts the campaign from the first level of the given episode, with fresh stats.
+func (g *Game) startCampaign(ep int) error {
+	if g.campaignDef == nil {
+		c, err := defaultCampaign()
+		if err != nil {
+			return err
+		}
+		g.campaignDef = c
+	}
+	if ep < 0 || ep >= len(g.campaignDef.episodes) {
+		return fmt.Errorf("episode %d out of range, expect 1 to %d", ep+1, len(g.campaignDef.episodes))
+	}
+	g.campaign = &campaignProgress{Episode: ep}
+	return g.loadCampaignLevel()
+}
+
+// loadCampaignLevel loads the current level of the campaign.
+func (g *Game) loadCampaignLevel() error {
+	lvl := g.currentLevel()
+	if err := g.loadMap("maps/" + lvl.mapName); err != nil {
+		return err
+	}
+	e := g.campaignDef.episodes[g.campaign.Episode]
+	g.message = fmt.Sprintf("%s, level %d: %s", e.name, g.campaign.Level+1, lvl.name)
+	return nil
+}
+
+// endLevel ends the current level: shows the intermission in a campaign,
+// loads the next embedded map otherwise.
+func (g *Game) endLevel() error {
+	if g.campaign == nil {
+		return g.nextMap()
+	}
+	g.campaign.Intermission = true
+	return nil
+}
+
+// campaignDone returns true when the current level is the last one of the campaign.
+func (g *Game) campaignDone() bool {
+	return g.campaign.Episode == len(g.campaignDef.episodes)-1 &&
+		g.campaign.Level == len(g.campaignDef.episodes[g.campaign.Episode].levels)-1
+}
+
+// nextLevel carries the stats and goes to the next level of the campaign,
+// starting over after the last one.
+func (g *Game) nextLevel() error {
+	if g.campaignDone() {
+		return g.startCampaign(0)
+	}
+	p := g.campaign
+	p.Total = p.Total.add(g.stats)
+	p.Intermission = false
+	p.Level++
+	if p.Level >= len(g.campaignDef.episodes[p.Episode].levels) {
+		p.Episode, p.Level = p.Episode+1, 0
+	}
+	return g.loadCampaignLevel()
+}
+
+// intermissionText returns the stats of the finished level, with the campaign totals.
+func (g *Game) intermissionText() string {
+	lvl, s := g.currentLevel(), g.stats
+	total := g.campaign.Total.add(s)
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s\nLevel %d: %s completed\n\n", g.campaignDef.episodes[g.campaign.Episode].name, g.campaign.Level+1, lvl.name)
+	fmt.Fprintf(&buf, "Time      %6s   Par %s\n", formatTicks(s.Ticks), formatTicks(lvl.par))
+	fmt.Fprintf(&buf, "Kills     %5d%%\n", percent(s.Kills, s.TotalKills))
+	fmt.Fprintf(&buf, "Secrets   %5d%%\n", percent(s.Secrets, s.TotalSecrets))
+	fmt.Fprintf(&buf, "Treasure  %5d%%\n\n", percent(s.Treasures, s.TotalTreasures))
+	if g.campaignDone() {
+		buf.WriteString("Campaign completed!\n")
+	}
+	fmt.Fprintf(&buf, "Total time %s, kills %d%%, secrets %d%%, treasure %d%%\n\n", formatTicks(total.Ticks),
+		percent(total.Kills, total.TotalKills), percent(total.Secrets, total.TotalSecrets), percent(total.Treasures, total.TotalTreasures))
+	buf.WriteString("Press Enter or Space to continue")
+	return buf.String()
+}
+
+// drawIntermission draws the intermission screen over the frame.
+func (g *Game) drawIntermission(img *ebiten.Image) {
+	if g.campaign == nil || !g.campaign.Intermission {
+		return
+	}
+	width, height := g.screenSize()
+	vector.DrawFilledRect(img, 0, 0, float32(width), float32(height), color.RGBA{A: 0xe0}, false)
+	ebitenutil.DebugPrintAt(img, g.intermissionText(), width/3, height/3)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestDefaultCampaign(t *testing.T) {
+	t.Parallel()
+
+	c, err := defaultCampaign()
+	if err != nil {
+		t.Fatalf("defaultCampaign: %s", err)
+	}
+	for _, e := range c.episodes {
+		for _, l := range e.levels {
+			buf, err := mapData.ReadFile("maps/" + l.mapName)
+			if err != nil {
+				t.Fatalf("readFile: %s", err)
+			}
+			lvl, err := parseLevel(buf)
+			if err != nil {
+				t.Fatalf("%s: parseLevel: %s", l.mapName, err)
+			}
+			exits := 0
+			for _, tr := range lvl.triggers {
+				if !tr.exit {
+					continue
+				}
+				exits++
+				if tr.rect.Min == image.Pt(int(lvl.spawn.X), int(lvl.spawn.Y)) {
+					t.Errorf("%s: exit on the spawn", l.mapName)
+				}
+				if p := lvl.world[tr.rect.Min.Y][tr.rect.Min.X]; p.solid() {
+					t.Errorf("%s: exit %v in a wall", l.mapName, tr.rect)
+				}
+			}
+			if exits == 0 {
+				t.Errorf("%s: no exit", l.mapName)
+			}
+			if l.par == 0 {
+				t.Errorf("%s: no par time", l.mapName)
+			}
+		}
+	}
+}
+
+func TestParseCampaign(t *testing.T) {
+	t.Parallel()
+
+	c, err := parseCampaign([]byte("# Comment.\n@episode One%21\n@level map1 1:05 A%20b\n@level map2 0:10\n@episode Two\n@level map3 10:00\n"))
+	if err != nil {
+		t.Fatalf("parseCampaign: %s", err)
+	}
+	if expect, got := 2, len(c.episodes); expect != got {
+		t.Fatalf("unexpected episode count, expect %d, got %d", expect, got)
+	}
+	if expect, got := (campaignLevel{mapName: "map1", name: "A b", par: 65 * tickRate}), c.episodes[0].levels[0]; expect != got {
+		t.Errorf("unexpected level:\nexpect:\t%#v\ngot:\t%#v", expect, got)
+	}
+	if expect, got := "One!", c.episodes[0].name; expect != got {
+		t.Errorf("unexpected episode name, expect %q, got %q", expect, got)
+	}
+	if expect, got := "map2", c.episodes[0].levels[1].name; expect != got {
+		t.Errorf("unexpected default level name, expect %q, got %q", expect, got)
+	}
+
+	for _, tc := range []struct {
+		data, err string
+	}{
+		{"", "no episodes"},
+		{"@episode One\n", "has no levels"},
+		{"@level map1 0:10\n", "before the first episode"},
+		{"@episode One\n@level nope 0:10\n", "unknown map"},
+		{"@episode One\n@level map1 10\n", "invalid par time"},
+		{"@episode One\n@level map1 0:60\n", "invalid par time"},
+		{"@episode One\n@boss map1\n", "unknown directive"},
+	} {
+		if _, err := parseCampaign([]byte(tc.data)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: unexpected error, expect %q, got %v", tc.data, tc.err, err)
+		}
+	}
+}
+
+// testCampaign returns a game on the first level of a campaign of 2 episodes.
+func testCampaign(t *testing.T) *Game {
+	t.Helper()
+
+	c, err := parseCampaign([]byte("@episode One\n@level map1 0:05\n@level map2 0:10\n@episode Two\n@level map3 0:20\n"))
+	if err != nil {
+		t.Fatalf("parseCampaign: %s", err)
+	}
+	g := &Game{campaignDef: c}
+	if err := g.startCampaign(0); err != nil {
+		t.Fatalf("startCampaign: %s", err)
+	}
+	return g
+}
+
+// reachExit moves the player next to the exit of map1 and walks into it.
+func reachExit(t *testing.T, g *Game) {
+	t.Helper()
+
+	g.pos, g.dir = math2.Pt(5.8, 4.5), math2.Pt(1, 0)
+	walk(t, g, actForward, 10)
+}
+
+func TestCampaignProgress(t *testing.T) {
+	t.Parallel()
+
+	g := testCampaign(t)
+	if expect, got := "map1", g.mapName; expect != got {
+		t.Fatalf("unexpected map, expect %q, got %q", expect, got)
+	}
+	if expect, got := 1, g.stats.TotalTreasures; expect != got {
+		t.Fatalf("unexpected treasure count, expect %d, got %d", expect, got)
+	}
+
+	// Pick up the treasure on the way.
+	g.pos = math2.Pt(1.6, 1.6)
+	walk(t, g, 0, 1)
+	if expect, got := 1, g.stats.Treasures; expect != got {
+		t.Fatalf("treasure not picked up, expect %d, got %d", expect, got)
+	}
+	if len(g.objects) != 0 {
+		t.Fatalf("treasure still in the level: %v", g.objects)
+	}
+
+	reachExit(t, g)
+	if !g.campaign.Intermission {
+		t.Fatal("level not ended at the exit")
+	}
+	ticks, pos := g.stats.Ticks, g.pos
+	// Frozen during the intermission.
+	walk(t, g, actForward, 30)
+	if g.stats.Ticks != ticks || g.pos != pos {
+		t.Fatalf("game running during the intermission: %d %v", g.stats.Ticks, g.pos)
+	}
+	text := g.intermissionText()
+	for _, expect := range []string{"Level 1: map1 completed", "Par 0:05", "Treasure    100%", "Kills       100%"} {
+		if !strings.Contains(text, expect) {
+			t.Errorf("missing %q in the intermission:\n%s", expect, text)
+		}
+	}
+
+	// Next level, the stats carried.
+	walk(t, g, actUse, 1)
+	if expect, got := "map2", g.mapName; expect != got {
+		t.Fatalf("unexpected map, expect %q, got %q", expect, got)
+	}
+	if g.campaign.Intermission {
+		t.Fatal("still in the intermission")
+	}
+	if expect, got := (levelStats{Ticks: ticks, Treasures: 1, TotalTreasures: 1}), g.campaign.Total; expect != got {
+		t.Errorf("unexpected total:\nexpect:\t%#v\ngot:\t%#v", expect, got)
+	}
+	if expect, got := (levelStats{TotalKills: 1, TotalTreasures: 1}), g.stats; expect != got {
+		t.Errorf("unexpected level stats:\nexpect:\t%#v\ngot:\t%#v", expect, got)
+	}
+
+	// Skipping goes to the next episode, then back to the start after the last level.
+	walk(t, g, actNextMap, 1)
+	if expect, got := (campaignProgress{Episode: 1, Total: g.campaign.Total}), *g.campaign; expect != got || g.mapName != "map3" {
+		t.Fatalf("unexpected progress on %s:\nexpect:\t%#v\ngot:\t%#v", g.mapName, expect, got)
+	}
+	if err := g.endLevel(); err != nil {
+		t.Fatalf("endLevel: %s", err)
+	}
+	if text := g.intermissionText(); !strings.Contains(text, "Campaign completed!") {
+		t.Errorf("missing the campaign end in the intermission:\n%s", text)
+	}
+	walk(t, g, actJump, 1)
+	if expect, got := (campaignProgress{}), *g.campaign; expect != got || g.mapName != "map1" {
+		t.Fatalf("unexpected progress on %s:\nexpect:\t%#v\ngot:\t%#v", g.mapName, expect, got)
+	}
+}
+
+func TestAttack(t *testing.T) {
+	t.Parallel()
+
+	g := newTriggerGame(t, "@spawn 1.5 1.5\n@object enemy 3.5 1.5\n@object enemy 1 1.5\n"+triggerCorridor)
+	if expect, got := 2, g.stats.TotalKills; expect != got {
+		t.Fatalf("unexpected enemy count, expect %d, got %d", expect, got)
+	}
+	// Out of reach.
+	walk(t, g, actUse, 1)
+	if g.stats.Kills != 0 {
+		t.Fatal("killed an enemy out of reach")
+	}
+	// In front and in reach, the one behind is left alone.
+	g.pos = math2.Pt(2.5, 1.5)
+	walk(t, g, actUse, 1)
+	if expect, got := 1, g.stats.Kills; expect != got {
+		t.Fatalf("unexpected kills, expect %d, got %d", expect, got)
+	}
+	walk(t, g, actUse, 1)
+	if expect, got := 1, g.stats.Kills; expect != got {
+		t.Fatalf("killed the enemy behind, expect %d kills, got %d", expect, got)
+	}
+	if expect, got := math2.Pt(1, 1.5), g.objects[0].pos; len(g.objects) != 1 || expect != got {
+		t.Fatalf("unexpected objects left: %v", g.objects)
+	}
+}
+
+func TestCampaignSaveState(t *testing.T) {
+	t.Parallel()
+
+	g := testCampaign(t)
+	walk(t, g, actNextMap, 1)
+	walk(t, g, actForward, 10)
+	buf, err := g.marshalState()
+	if err != nil {
+		t.Fatalf("marshalState: %s", err)
+	}
+
+	g2 := &Game{campaignDef: g.campaignDef}
+	if err := g2.unmarshalState(buf); err != nil {
+		t.Fatalf("unmarshalState: %s", err)
+	}
+	if *g.campaign != *g2.campaign || g.stats != g2.stats {
+		t.Errorf("unexpected state:\nexpect:\t%#v %#v\ngot:\t%#v %#v", *g.campaign, g.stats, *g2.campaign, g2.stats)
+	}
+	if err := g2.nextLevel(); err != nil {
+		t.Fatalf("nextLevel: %s", err)
+	}
+	if expect, got := "map3", g2.mapName; expect != got {
+		t.Errorf("unexpected map, expect %q, got %q", expect, got)
+	}
+}
+
+func TestFormatStats(t *testing.T) {
+	t.Parallel()
+
+	if expect, got := "1:05", formatTicks(65*tickRate+tickRate-1); expect != got {
+		t.Errorf("unexpected time, expect %q, got %q", expect, got)
+	}
+	for _, tc := range []struct{ n, total, expect int }{{0, 0, 100}, {1, 3, 33}, {3, 3, 100}, {0, 2, 0}} {
+		if got := percent(tc.n, tc.total); tc.expect != got {
+			t.Errorf("percent(%d, %d): expect %d, got %d", tc.n, tc.total, tc.expect, got)
+		}
+	}
+}
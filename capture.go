@@ -0,0 +1,329 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"runtime"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Capture settings.
+const (
+	captureDefaultFPS     = 15
+	captureDefaultSeconds = 5
+	captureMaxSeconds     = 60
+	captureGIFMaxSeconds  = 20 // GIF frames are kept in memory until the end.
+	captureGIFScale       = 2  // GIF frames are downscaled by this factor.
+	capturePNGQueue       = 32 // PNG frames waiting to be encoded before the draw blocks.
+)
+
+// capture holds the screenshot and frame capture state.
+type capture struct {
+	screenshot bool // Pending screenshot, taken at the end of the next draw.
+
+	recording bool
+	format    string // "png" or "gif".
+	name      string // Output name, without extension.
+	interval  uint64 // Ticks between frames.
+	nextTick  uint64 // Tick of the next frame.
+	endTick   uint64
+	lastTick  uint64 // Tick of the last frame, for the GIF delays.
+	frames    int
+
+	gif *gif.GIF
+	png *pngWriter // PNG sequence, encoded and written in the background.
+
+	closing []*pngWriter // Stopped PNG sequences, still writing their last frames.
+}
+
+// pngWriter encodes and writes the PNG frames on a goroutine, in order, to keep the draw fast.
+type pngWriter struct {
+	name   string
+	frames chan *image.RGBA
+	done   chan error // Result of the whole sequence, once the frames channel is closed.
+
+	zip *zip.Writer   // PNG sequence in the browser, downloaded as a single zip.
+	buf *bytes.Buffer // Zip content.
+}
+
+// newPNGWriter starts the writer goroutine for the sequence.
+func newPNGWriter(name string) *pngWriter {
+	w := &pngWriter{
+		name:   name,
+		frames: make(chan *image.RGBA, capturePNGQueue),
+		done:   make(chan error, 1),
+	}
+	if runtime.GOOS == "js" {
+		w.buf = &bytes.Buffer{}
+		w.zip = zip.NewWriter(w.buf)
+	}
+	go func() { w.done <- w.run() }()
+	return w
+}
+
+// run writes the frames until the channel is closed. On error, the remaining frames are dropped.
+func (w *pngWriter) run() error {
+	var err error
+	for n := 1; ; n++ {
+		img, ok := <-w.frames
+		if !ok {
+			break
+		}
+		if err == nil {
+			err = w.writeFrame(n, img)
+		}
+	}
+	if err != nil || w.zip == nil {
+		return err
+	}
+	if err := w.zip.Close(); err != nil {
+		return fmt.Errorf("zip close: %w", err)
+	}
+	return saveFile(w.name+".zip", w.buf.Bytes())
+}
+
+func (w *pngWriter) writeFrame(n int, img *image.RGBA) error {
+	buf, err := encodePNG(img)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("frame-%05d.png", n)
+	if w.zip != nil {
+		f, err := w.zip.Create(name)
+		if err != nil {
+			return fmt.Errorf("zip create: %w", err)
+		}
+		if _, err := f.Write(buf); err != nil {
+			return fmt.Errorf("zip write: %w", err)
+		}
+		return nil
+	}
+	if err := saveFile(w.name+"/"+name, buf); err != nil {
+		return fmt.Errorf("saveFile: %w", err)
+	}
+	return nil
+}
+
+// close ends the sequence. The pending frames are still written, the result is sent to done.
+func (w *pngWriter) close() {
+	close(w.frames)
+}
+
+// captureName returns an output name timestamped to the millisecond, so quick captures don't overwrite each other.
+func captureName(prefix string, now time.Time) string {
+	return prefix + now.Format("20060102-150405.000")
+}
+
+// pollCapture reports the stopped PNG sequences done writing, without waiting for the others.
+func (g *Game) pollCapture() {
+	c := &g.capture
+	pending := c.closing[:0]
+	for _, w := range c.closing {
+		select {
+		case err := <-w.done:
+			if err != nil {
+				g.message = fmt.Sprintf("Capture %s failed: %s", w.name, err)
+			}
+		default:
+			pending = append(pending, w)
+		}
+	}
+	c.closing = pending
+}
+
+// flushCapture stops the capture and waits for the PNG sequences still writing, before exiting.
+func (g *Game) flushCapture() error {
+	errs := []error{g.stopCapture()}
+	for _, w := range g.capture.closing {
+		errs = append(errs, <-w.done)
+	}
+	g.capture.closing = nil
+	return errors.Join(errs...)
+}
+
+// takeScreenshot asks for a screenshot of the next frame, with the overlays.
+func (g *Game) takeScreenshot() {
+	g.capture.screenshot = true
+}
+
+// startCapture starts capturing the frames for the given duration at the given frame rate.
+func (g *Game) startCapture(format string, seconds float64, fps int) error {
+	if g.capture.recording {
+		return errors.New("already capturing")
+	}
+	if format != "png" && format != "gif" {
+		return fmt.Errorf("unknown format %q, expect png or gif", format)
+	}
+	maxSeconds := float64(captureMaxSeconds)
+	if format == "gif" {
+		maxSeconds = captureGIFMaxSeconds
+	}
+	if seconds <= 0 || seconds > maxSeconds {
+		return fmt.Errorf("duration %g out of range, expect up to %g seconds", seconds, maxSeconds)
+	}
+	if fps < 1 || fps > tickRate {
+		return fmt.Errorf("frame rate %d out of range, expect 1 to %d", fps, tickRate)
+	}
+
+	g.capture = capture{
+		closing:   g.capture.closing,
+		recording: true,
+		format:    format,
+		name:      captureName("captures/", time.Now()),
+		interval:  uint64(tickRate / fps),
+		nextTick:  g.tick,
+		endTick:   g.tick + uint64(seconds*tickRate),
+		lastTick:  g.tick,
+	}
+	if format == "gif" {
+		g.capture.gif = &gif.GIF{}
+	} else {
+		g.capture.png = newPNGWriter(g.capture.name)
+	}
+	g.message = fmt.Sprintf("Capturing %gs at %dfps", seconds, fps)
+	return nil
+}
+
+// stopCapture ends the capture and writes the result.
+// The PNG frames left in the queue are written in the background, not to stall the frame.
+func (g *Game) stopCapture() error {
+	c := &g.capture
+	if !c.recording {
+		return nil
+	}
+	defer func() { *c = capture{closing: c.closing} }()
+
+	g.message = fmt.Sprintf("Captured %d frames in %s", c.frames, c.name)
+	switch {
+	case c.gif != nil:
+		if c.frames == 0 {
+			return nil
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, c.gif); err != nil {
+			return fmt.Errorf("gif.EncodeAll: %w", err)
+		}
+		g.message += ".gif"
+		return saveFile(c.name+".gif", buf.Bytes())
+	case c.png != nil:
+		if c.png.zip != nil {
+			g.message += ".zip"
+		} else {
+			g.message += "/"
+		}
+		c.png.close()
+		c.closing = append(c.closing, c.png)
+	}
+	return nil
+}
+
+// toggleCapture starts a capture with the default settings, or stops the current one.
+func (g *Game) toggleCapture() error {
+	if g.capture.recording {
+		return g.stopCapture()
+	}
+	return g.startCapture("gif", captureDefaultSeconds, captureDefaultFPS)
+}
+
+// captureScreen reads the screen when needed by a screenshot or the capture.
+// Called at the end of the draw, so the overlays are included.
+func (g *Game) captureScreen(screen *ebiten.Image) {
+	g.pollCapture()
+	c := &g.capture
+	if !c.screenshot && (!c.recording || g.tick < c.nextTick) {
+		return
+	}
+	img := image.NewRGBA(screen.Bounds())
+	screen.ReadPixels(img.Pix)
+	if err := g.captureImage(img); err != nil {
+		g.message = err.Error()
+		_ = g.stopCapture() // Best effort.
+	}
+}
+
+// captureImage saves the screenshot and adds the capture frame from the screen image.
+func (g *Game) captureImage(img *image.RGBA) error {
+	// The screen alpha is not meaningful.
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+
+	c := &g.capture
+	if c.screenshot {
+		c.screenshot = false
+		buf, err := encodePNG(img)
+		if err != nil {
+			return err
+		}
+		name := captureName("screenshots/", time.Now()) + ".png"
+		if err := saveFile(name, buf); err != nil {
+			return fmt.Errorf("saveFile %q: %w", name, err)
+		}
+		g.message = "Saved " + name
+	}
+
+	if !c.recording || g.tick < c.nextTick {
+		return nil
+	}
+	if err := g.addCaptureFrame(img); err != nil {
+		return err
+	}
+	// Skip the missed frames when the game runs slower than the capture.
+	for c.nextTick <= g.tick {
+		c.nextTick += c.interval
+	}
+	if c.nextTick > c.endTick {
+		return g.stopCapture()
+	}
+	return nil
+}
+
+func (g *Game) addCaptureFrame(img *image.RGBA) error {
+	c := &g.capture
+	c.frames++
+	if c.gif != nil {
+		if c.frames > 1 {
+			// The delay of the previous frame, in 100ths of second.
+			c.gif.Delay[len(c.gif.Delay)-1] = int((g.tick - c.lastTick) * 100 / tickRate)
+		}
+		c.gif.Image = append(c.gif.Image, quantize(img, captureGIFScale))
+		c.gif.Delay = append(c.gif.Delay, int(c.interval*100/tickRate))
+		c.lastTick = g.tick
+		return nil
+	}
+
+	// The image is not reused by the caller, the writer can keep it.
+	c.png.frames <- img
+	return nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("png.Encode: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// quantize returns the image downscaled by the given factor with the web safe palette.
+// The palette being a 6x6x6 color cube, the index is computed directly instead of searched.
+func quantize(img *image.RGBA, scale int) *image.Paletted {
+	bounds := img.Bounds()
+	out := image.NewPaletted(image.Rect(0, 0, max(1, bounds.Dx()/scale), max(1, bounds.Dy()/scale)), palette.WebSafe)
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			off := img.PixOffset(bounds.Min.X+x*scale, bounds.Min.Y+y*scale)
+			r, g, b := int(img.Pix[off]), int(img.Pix[off+1]), int(img.Pix[off+2])
+			out.Pix[y*out.Stride+x] = uint8((r+25)/51*36 + (g+25)/51*6 + (b+25)/51)
+		}
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartCapture(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		format  string
+		seconds float64
+		fps     int
+	}{
+		{"format", "bmp", 1, 10},
+		{"no duration", "gif", 0, 10},
+		{"gif too long", "gif", captureGIFMaxSeconds + 1, 10},
+		{"png too long", "png", captureMaxSeconds + 1, 10},
+		{"no fps", "gif", 1, 0},
+		{"fps too high", "gif", 1, tickRate + 1},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g := &Game{}
+			if err := g.startCapture(tc.format, tc.seconds, tc.fps); err == nil {
+				t.Fatal("expected error")
+			}
+			if g.capture.recording {
+				t.Fatal("capture started on error")
+			}
+		})
+	}
+
+	g := &Game{}
+	if err := g.startCapture("gif", 1, 10); err != nil {
+		t.Fatalf("startCapture: %s", err)
+	}
+	if err := g.startCapture("gif", 1, 10); err == nil {
+		t.Fatal("expected error when already capturing")
+	}
+}
+
+func TestCaptureGIF(t *testing.T) {
+	t.Parallel()
+
+	g := &Game{}
+	if err := g.startCapture("gif", 1, 15); err != nil {
+		t.Fatalf("startCapture: %s", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	// Draw every tick for half a second, and skip a tick to simulate a slow frame.
+	for ; g.tick < tickRate/2; g.tick++ {
+		if g.tick == 8 {
+			continue
+		}
+		if err := g.captureImage(img); err != nil {
+			t.Fatalf("captureImage: %s", err)
+		}
+	}
+	if !g.capture.recording {
+		t.Fatal("capture stopped early")
+	}
+	// Frames at ticks 0, 4, 9, 12, 16, 20, 24, 28.
+	if expect, got := 8, len(g.capture.gif.Image); expect != got {
+		t.Fatalf("unexpected frame count, expect %d, got %d", expect, got)
+	}
+	if expect, got := fmt.Sprint([]int{6, 8, 5, 6, 6, 6, 6, 6}), fmt.Sprint(g.capture.gif.Delay); expect != got {
+		t.Errorf("unexpected delays, expect %s, got %s", expect, got)
+	}
+	if expect, got := image.Rect(0, 0, 8/captureGIFScale, 4/captureGIFScale), g.capture.gif.Image[0].Rect; expect != got {
+		t.Errorf("unexpected frame size, expect %v, got %v", expect, got)
+	}
+	if img.Pix[3] != 0xff {
+		t.Errorf("alpha not forced opaque, got %d", img.Pix[3])
+	}
+}
+
+func TestCaptureName(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	a, b := captureName("captures/", now), captureName("captures/", now.Add(40*time.Millisecond))
+	if expect := "captures/20240102-030405.000"; a != expect {
+		t.Errorf("unexpected name:\nexpect:\t%s\ngot:\t%s", expect, a)
+	}
+	if a == b {
+		t.Errorf("captures within the same second should have different names: %s", a)
+	}
+}
+
+func TestPollCapture(t *testing.T) {
+	t.Parallel()
+
+	// Stopped sequences, still writing.
+	ok, failed := &pngWriter{name: "ok", done: make(chan error, 1)}, &pngWriter{name: "failed", done: make(chan error, 1)}
+	g := &Game{}
+	g.capture.closing = []*pngWriter{ok, failed}
+	g.pollCapture()
+	if len(g.capture.closing) != 2 {
+		t.Fatalf("pending sequences dropped: %d left", len(g.capture.closing))
+	}
+
+	failed.done <- errors.New("disk full")
+	g.pollCapture()
+	if len(g.capture.closing) != 1 || g.capture.closing[0] != ok || !strings.Contains(g.message, "failed: disk full") {
+		t.Fatalf("unexpected state: %d pending, message %q", len(g.capture.closing), g.message)
+	}
+
+	// The exit waits for the others.
+	go func() { ok.done <- nil }()
+	if err := g.flushCapture(); err != nil || len(g.capture.closing) != 0 {
+		t.Errorf("unexpected flush: %v, %d pending", err, len(g.capture.closing))
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	// Only the top left pixel of each 2x2 block is sampled.
+	copy(img.Pix[0:], []byte{0xff, 0, 0, 0xff, 1, 2, 3, 0xff})
+	copy(img.Pix[8:], []byte{0x30, 0x99, 0xf0, 0xff})
+	out := quantize(img, 2)
+	if expect, got := image.Rect(0, 0, 2, 1), out.Rect; expect != got {
+		t.Fatalf("unexpected size, expect %v, got %v", expect, got)
+	}
+	for i, expect := range []uint32{0xff0000, 0x3399ff} {
+		r, g, b, _ := palette.WebSafe[out.Pix[i]].RGBA()
+		if got := (r>>8)<<16 | (g>>8)<<8 | b>>8; expect != got {
+			t.Errorf("pixel %d: unexpected color, expect %06x, got %06x", i, expect, got)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+// runCommand runs the given subcommand instead of the game.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "validate":
+		return cmdValidate(args)
+	case "import-wolf3d":
+		return cmdImportWolf3D(args)
+	case "generate":
+		return cmdGenerate(args)
+	case "render":
+		return cmdRender(args)
+	case "terminal":
+		return cmdTerminal(args)
+	case "demo":
+		return cmdDemo(args)
+	case "server":
+		return cmdServer(args)
+	case "join":
+		return cmdJoin(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
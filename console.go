@@ -0,0 +1,587 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Console settings.
+const (
+	consoleLines         = 200            // Maximum number of output lines kept.
+	consoleHistory       = 100            // Maximum number of commands kept in the history.
+	consoleStartupScript = "autoexec.cfg" // Script executed at startup, if present.
+	consoleExecDepth     = 8              // Maximum nesting of the scripts, which can exec each other.
+)
+
+// console is the drop-down developer console.
+type console struct {
+	open    bool
+	input   string
+	lines   []string // Output.
+	history []string
+	histPos int // Position in the history while browsing it, len(history) when not browsing.
+	depth   int // Nesting of the running scripts.
+}
+
+// consoleCommand is a command of the console.
+type consoleCommand struct {
+	usage    string
+	help     string
+	run      func(g *Game, args []string) error
+	complete func(g *Game) []string // Candidates of the first argument, if any.
+	sim      bool                   // Changes the simulation state, refused during a demo.
+}
+
+// cvar is a console variable, backed by a game setting.
+type cvar struct {
+	help string
+	get  func(g *Game) string
+	set  func(g *Game, value string) error
+	sim  bool // Changes the simulation state, refused during a demo.
+}
+
+// simCvar flags the cvar as changing the simulation state.
+func simCvar(v cvar) cvar {
+	v.sim = true
+	return v
+}
+
+// boolCvar returns a cvar for the given boolean setting.
+func boolCvar(help string, field func(g *Game) *bool) cvar {
+	return cvar{
+		help: help,
+		get:  func(g *Game) string { return strconv.FormatBool(*field(g)) },
+		set: func(g *Game, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", value)
+			}
+			*field(g) = v
+			return nil
+		},
+	}
+}
+
+// intCvar returns a cvar for the given integer setting, clamped to the given range.
+func intCvar(help string, lo, hi int, field func(g *Game) *int) cvar {
+	return cvar{
+		help: help,
+		get:  func(g *Game) string { return strconv.Itoa(*field(g)) },
+		set: func(g *Game, value string) error {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", value)
+			}
+			*field(g) = min(hi, max(lo, v))
+			return nil
+		},
+	}
+}
+
+// consoleCvars returns the console variables by name.
+func consoleCvars() map[string]cvar {
+	return map[string]cvar{
+		"showRays":           simCvar(boolCvar("Draw the rays on the minimap.", func(g *Game) *bool { return &g.showRays })),
+		"showHighlight":      simCvar(boolCvar("Highlight the player's case on the minimap.", func(g *Game) *bool { return &g.showHighlight })),
+		"showMinimapGrid":    simCvar(boolCvar("Draw the minimap grid.", func(g *Game) *bool { return &g.showMinimapGrid })),
+		"hideInvisibleWalls": simCvar(boolCvar("Hide the walls not in view on the minimap.", func(g *Game) *bool { return &g.hideInvisibleWalls })),
+		"fogOfWar":           simCvar(boolCvar("Only show the explored walls on the minimap.", func(g *Game) *bool { return &g.fogOfWar })),
+		"mouseLook":          boolCvar("Look up/down with the mouse, capturing the cursor.", func(g *Game) *bool { return &g.mouseLook }),
+		"noclip":             simCvar(boolCvar("Walk through the walls.", func(g *Game) *bool { return &g.noclip })),
+		"mapMod":             simCvar(intCvar("Minimap mode, -1: hidden, 0: minimap, 1: full map, 2: rotating.", -1, 2, func(g *Game) *int { return &g.mapMod })),
+		"minimapZoom":        simCvar(intCvar("Pixels per case of the rotating minimap.", minimapMinZoom, minimapMaxZoom, func(g *Game) *int { return &g.minimapZoom })),
+		"renderScale": {
+			help: "Render resolution in percent of the screen, 25 to 200.",
+			get:  func(g *Game) string { return strconv.FormatFloat(g.renderScaleValue()*100, 'f', -1, 64) },
+			set: func(g *Game, value string) error {
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return fmt.Errorf("invalid number %q", value)
+				}
+				return g.setRenderScale(v / 100)
+			},
+		},
+		"renderFilter": {
+			help: "Upscale filter, nearest or linear.",
+			get:  func(g *Game) string { return filterName(g.renderFilter) },
+			set: func(g *Game, value string) error {
+				f, err := parseFilter(value)
+				if err != nil {
+					return err
+				}
+				g.renderFilter = f
+				return nil
+			},
+		},
+		"dynamicResolution": boolCvar("Adjust the render scale to the frame time.", func(g *Game) *bool { return &g.dynamicRes.enabled }),
+		"dynamicTarget": {
+			help: "Frame render time target of the dynamic resolution, in milliseconds.",
+			get: func(g *Game) string {
+				if g.dynamicRes.target == 0 {
+					return strconv.FormatInt(dynamicTarget.Milliseconds(), 10)
+				}
+				return strconv.FormatFloat(float64(g.dynamicRes.target)/float64(time.Millisecond), 'f', -1, 64)
+			},
+			set: func(g *Game, value string) error {
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil || v <= 0 {
+					return fmt.Errorf("invalid duration %q", value)
+				}
+				g.dynamicRes.target = time.Duration(v * float64(time.Millisecond))
+				return nil
+			},
+		},
+		"headBob":     boolCvar("Bob the view while walking.", func(g *Game) *bool { return &g.effects.headBob }),
+		"screenShake": boolCvar("Shake the screen.", func(g *Game) *bool { return &g.effects.shake }),
+		"flashes":     boolCvar("Flash the screen on damage or pickup.", func(g *Game) *bool { return &g.effects.flashes }),
+		"fades":       boolCvar("Fade out/in when changing map.", func(g *Game) *bool { return &g.effects.fades }),
+		"profiler": {
+			help: "Show the frame time profiler.",
+			get:  func(g *Game) string { return strconv.FormatBool(g.profiler != nil) },
+			set: func(g *Game, value string) error {
+				v, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("invalid boolean %q", value)
+				}
+				if !v {
+					g.profiler = nil
+				} else if g.profiler == nil {
+					g.profiler = &profiler{}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// consoleCommands returns the console commands by name.
+func consoleCommands() map[string]consoleCommand {
+	return map[string]consoleCommand{
+		"help":       {usage: "help", help: "List the commands and cvars.", run: cmdConsoleHelp},
+		"map":        {usage: "map <name>", help: "Load an embedded map or a map file, leaving the campaign.", run: cmdConsoleMap, sim: true, complete: embeddedMapNames},
+		"campaign":   {usage: "campaign [episode]", help: "Start the campaign from the given episode, 1 by default.", run: cmdConsoleCampaign, sim: true},
+		"setpos":     {usage: "setpos <x> <y> [angle]", help: "Teleport the player, angle in degrees.", run: cmdConsoleSetPos, sim: true},
+		"noclip":     {usage: "noclip", help: "Toggle walking through the walls.", run: cmdConsoleNoclip, sim: true},
+		"fov":        {usage: "fov [degrees]", help: "Print or set the field of view.", run: cmdConsoleFOV, sim: true},
+		"screenshot": {usage: "screenshot", help: "Save the next frame as PNG, with the overlays.", run: cmdConsoleScreenshot},
+		"capture":    {usage: "capture <png|gif|stop> [seconds] [fps]", help: "Capture the frames as a PNG sequence or an animated GIF.", run: cmdConsoleCapture, complete: func(*Game) []string { return []string{"gif", "png", "stop"} }},
+		"toggle":     {usage: "toggle <cvar>", help: "Toggle a boolean cvar.", run: cmdConsoleToggle, complete: cvarNames},
+		"exec":       {usage: "exec <file>", help: "Run the commands of a script file.", run: cmdConsoleExec},
+		"flash":      {usage: "flash [damage|pickup]", help: "Flash the screen.", run: cmdConsoleFlash, complete: func(*Game) []string { return []string{"damage", "pickup"} }},
+		"shake":      {usage: "shake [intensity] [seconds]", help: "Shake the screen, intensity from 0 to 1.", run: cmdConsoleShake},
+		"clear":      {usage: "clear", help: "Clear the console.", run: func(g *Game, _ []string) error { g.console.lines = nil; return nil }},
+	}
+}
+
+// printf adds a line to the console output.
+func (c *console) printf(format string, args ...any) {
+	c.lines = append(c.lines, strings.Split(fmt.Sprintf(format, args...), "\n")...)
+	if len(c.lines) > consoleLines {
+		c.lines = c.lines[len(c.lines)-consoleLines:]
+	}
+}
+
+// exec runs the given command line, commands being separated by ';'.
+// Errors are printed in the console, the first one is returned.
+func (g *Game) exec(line string) error {
+	var first error
+	for _, cmdLine := range strings.Split(line, ";") {
+		if err := g.execCommand(strings.Fields(cmdLine)); err != nil {
+			g.console.printf("error: %s", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (g *Game) execCommand(fields []string) error {
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "//") {
+		return nil
+	}
+	name, args := fields[0], fields[1:]
+	if cmd, ok := consoleCommands()[name]; ok {
+		if cmd.sim && g.inDemo() {
+			return fmt.Errorf("%s: %w", name, errDemoRunning)
+		}
+		return cmd.run(g, args)
+	}
+	v, ok := consoleCvars()[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	switch len(args) {
+	case 0:
+		g.console.printf("%s = %s", name, v.get(g))
+		return nil
+	case 1:
+		if v.sim && g.inDemo() {
+			return fmt.Errorf("%s: %w", name, errDemoRunning)
+		}
+		if err := v.set(g, args[0]); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("usage: %s [value]", name)
+	}
+}
+
+// execScript runs the commands of the given file, one per line.
+func (g *Game) execScript(name string) error {
+	if g.console.depth >= consoleExecDepth {
+		return fmt.Errorf("%s: scripts nested too deep, max %d", name, consoleExecDepth)
+	}
+	g.console.depth++
+	defer func() { g.console.depth-- }()
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("readFile: %w", err)
+	}
+	var errs []error
+	for i, line := range strings.Split(string(buf), "\n") {
+		if err := g.exec(line); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", name, i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// execStartupScript runs the startup script when present.
+// Reading files is unsupported in the browser, where there is no script.
+func (g *Game) execStartupScript() {
+	if err := g.execScript(consoleStartupScript); err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, errors.ErrUnsupported) {
+		g.console.printf("%s", err)
+		g.message = "Startup script failed, see the console"
+	}
+}
+
+func cmdConsoleHelp(g *Game, _ []string) error {
+	cmds := consoleCommands()
+	for _, name := range sortedKeys(cmds) {
+		g.console.printf("%-24s %s", cmds[name].usage, cmds[name].help)
+	}
+	cvars := consoleCvars()
+	for _, name := range sortedKeys(cvars) {
+		g.console.printf("%-24s %s", name+" = "+cvars[name].get(g), cvars[name].help)
+	}
+	return nil
+}
+
+func cmdConsoleMap(g *Game, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: map <name>")
+	}
+	name := args[0]
+	if _, err := fs.Stat(mapData, "maps/"+name); err == nil {
+		name = "maps/" + name
+	}
+	mapName, lvl, err := loadLevelArg(name)
+	if err != nil {
+		return err
+	}
+	g.setLevel(mapName, lvl)
+	// Playing a single map.
+	g.campaign = nil
+	return nil
+}
+
+func cmdConsoleCampaign(g *Game, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: campaign [episode]")
+	}
+	ep := 1
+	if len(args) == 1 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", args[0])
+		}
+		ep = v
+	}
+	return g.startCampaign(ep - 1)
+}
+
+func cmdConsoleSetPos(g *Game, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errors.New("usage: setpos <x> <y> [angle]")
+	}
+	var vals [3]float64
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", arg)
+		}
+		vals[i] = v
+	}
+	if vals[1] < 0 || int(vals[1]) >= len(g.world) || vals[0] < 0 || int(vals[0]) >= len(g.world[int(vals[1])]) {
+		return fmt.Errorf("position %g,%g out of the map", vals[0], vals[1])
+	}
+	g.pos = math2.Pt(vals[0], vals[1])
+	if len(args) == 3 {
+		angle := math2.NewDegAngle(vals[2])
+		g.dir = math2.Pt(1, 0).Rotate(angle)
+		g.updatePlane()
+	}
+	return nil
+}
+
+func cmdConsoleNoclip(g *Game, _ []string) error {
+	g.noclip = !g.noclip
+	g.console.printf("noclip = %t", g.noclip)
+	return nil
+}
+
+func cmdConsoleFOV(g *Game, args []string) error {
+	if len(args) == 0 {
+		g.console.printf("fov = %g", g.fovDegrees())
+		return nil
+	}
+	deg, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", args[0])
+	}
+	return g.setFOV(deg)
+}
+
+func cmdConsoleScreenshot(g *Game, _ []string) error {
+	g.takeScreenshot()
+	return nil
+}
+
+func cmdConsoleCapture(g *Game, args []string) error {
+	if len(args) == 0 || args[0] == "stop" {
+		if !g.capture.recording {
+			return errors.New("usage: capture <png|gif> [seconds] [fps]")
+		}
+		return g.stopCapture()
+	}
+	seconds, fps := float64(captureDefaultSeconds), captureDefaultFPS
+	if len(args) > 1 {
+		v, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", args[1])
+		}
+		seconds = v
+	}
+	if len(args) > 2 {
+		v, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", args[2])
+		}
+		fps = v
+	}
+	return g.startCapture(args[0], seconds, fps)
+}
+
+func cmdConsoleFlash(g *Game, args []string) error {
+	c := flashDamage
+	if len(args) > 0 {
+		switch args[0] {
+		case "damage":
+		case "pickup":
+			c = flashPickup
+		default:
+			return fmt.Errorf("unknown flash %q, expect damage or pickup", args[0])
+		}
+	}
+	g.startFlash(c)
+	return nil
+}
+
+func cmdConsoleShake(g *Game, args []string) error {
+	vals := []float64{1, 0.5} // Intensity, seconds.
+	for i, arg := range args {
+		if i >= len(vals) {
+			return errors.New("usage: shake [intensity] [seconds]")
+		}
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid number %q", arg)
+		}
+		vals[i] = v
+	}
+	g.startShake(vals[0], vals[1])
+	return nil
+}
+
+func cmdConsoleToggle(g *Game, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: toggle <cvar>")
+	}
+	v, ok := consoleCvars()[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown cvar %q", args[0])
+	}
+	if v.sim && g.inDemo() {
+		return fmt.Errorf("%s: %w", args[0], errDemoRunning)
+	}
+	cur, err := strconv.ParseBool(v.get(g))
+	if err != nil {
+		return fmt.Errorf("%s is not a boolean", args[0])
+	}
+	return v.set(g, strconv.FormatBool(!cur))
+}
+
+func cmdConsoleExec(g *Game, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: exec <file>")
+	}
+	return g.execScript(args[0])
+}
+
+func embeddedMapNames(*Game) []string {
+	entries, err := mapData.ReadDir("maps")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, elem := range entries {
+		names = append(names, elem.Name())
+	}
+	return names
+}
+
+func cvarNames(*Game) []string { return sortedKeys(consoleCvars()) }
+
+// complete completes the last word of the console input.
+// The input is extended to the longest common prefix of the candidates,
+// which are printed when there are several.
+func (g *Game) complete() {
+	fields := strings.Fields(g.console.input)
+	if strings.HasSuffix(g.console.input, " ") || len(fields) == 0 {
+		fields = append(fields, "")
+	}
+	var candidates []string
+	if len(fields) == 1 {
+		candidates = append(sortedKeys(consoleCommands()), sortedKeys(consoleCvars())...)
+	} else if cmd, ok := consoleCommands()[fields[0]]; ok && cmd.complete != nil && len(fields) == 2 {
+		candidates = cmd.complete(g)
+	}
+
+	word := fields[len(fields)-1]
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(matches) == 1 {
+		prefix += " "
+	} else {
+		g.console.printf("%s", strings.Join(matches, "  "))
+	}
+	fields[len(fields)-1] = prefix
+	g.console.input = strings.Join(fields, " ")
+}
+
+// submit runs the console input and adds it to the history.
+func (g *Game) submit() {
+	line := strings.TrimSpace(g.console.input)
+	g.console.input = ""
+	if line == "" {
+		return
+	}
+	g.console.printf("> %s", line)
+	if n := len(g.console.history); n == 0 || g.console.history[n-1] != line {
+		g.console.history = append(g.console.history, line)
+		if len(g.console.history) > consoleHistory {
+			g.console.history = g.console.history[1:]
+		}
+	}
+	g.console.histPos = len(g.console.history)
+	_ = g.exec(line) // Errors are printed in the console.
+}
+
+// browseHistory replaces the input by the previous (-1) or next (1) command of the history.
+func (g *Game) browseHistory(delta int) {
+	c := &g.console
+	c.histPos = min(len(c.history), max(0, c.histPos+delta))
+	if c.histPos == len(c.history) {
+		c.input = ""
+		return
+	}
+	c.input = c.history[c.histPos]
+}
+
+// updateConsole handles the console inputs.
+// Returns true when the inputs are consumed by the console.
+func (g *Game) updateConsole() bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackquote) {
+		g.console.open = !g.console.open
+		g.console.histPos = len(g.console.history)
+		return true
+	}
+	if !g.console.open {
+		return false
+	}
+
+	for _, r := range ebiten.AppendInputChars(nil) {
+		if r != '`' {
+			g.console.input += string(r)
+		}
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		g.console.open = false
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter), inpututil.IsKeyJustPressed(ebiten.KeyNumpadEnter):
+		g.submit()
+	case inpututil.IsKeyJustPressed(ebiten.KeyTab):
+		g.complete()
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		g.browseHistory(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		g.browseHistory(1)
+	case repeatingKey(ebiten.KeyBackspace):
+		if r := []rune(g.console.input); len(r) > 0 {
+			g.console.input = string(r[:len(r)-1])
+		}
+	}
+	return true
+}
+
+// repeatingKey returns true when the key is pressed, repeating while held.
+func repeatingKey(key ebiten.Key) bool {
+	const delay, interval = 30, 3 // In ticks.
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || (d >= delay && (d-delay)%interval == 0)
+}
+
+// drawConsole draws the console over the top half of the screen.
+func (g *Game) drawConsole(img *ebiten.Image) {
+	if !g.console.open {
+		return
+	}
+	const lineHeight = 16
+	width, height := g.screenSize()
+	height /= 2
+	vector.DrawFilledRect(img, 0, 0, float32(width), float32(height), color.RGBA{A: 0xd0}, false)
+
+	n := height/lineHeight - 1
+	lines := g.console.lines[max(0, len(g.console.lines)-n):]
+	ebitenutil.DebugPrintAt(img, strings.Join(lines, "\n"), 4, height-(len(lines)+1)*lineHeight)
+	ebitenutil.DebugPrintAt(img, "] "+g.console.input+"_", 4, height-lineHeight)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestConsoleCommands(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	g.explored = newExploredSet(g.world)
+
+	if err := g.exec("setpos 1.5 3.5 90; showRays 1; toggle fogOfWar; minimapZoom 1000"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	if g.pos != math2.Pt(1.5, 3.5) || math.Abs(g.dir.Y-1) > 1e-9 || math.Abs(g.plane.X+0.66) > 1e-9 {
+		t.Errorf("unexpected position: %v %v %v", g.pos, g.dir, g.plane)
+	}
+	if !g.showRays || !g.fogOfWar || g.minimapZoom != minimapMaxZoom {
+		t.Errorf("unexpected cvars: %t %t %d", g.showRays, g.fogOfWar, g.minimapZoom)
+	}
+
+	// Reading a cvar prints it.
+	if err := g.exec("showRays"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	if got := g.console.lines[len(g.console.lines)-1]; got != "showRays = true" {
+		t.Errorf("unexpected output: %q", got)
+	}
+
+	// The field of view keeps the direction.
+	if err := g.exec("fov 90"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	if math.Abs(g.plane.Norm()-1) > 1e-9 || math.Abs(g.plane.X+1) > 1e-9 {
+		t.Errorf("unexpected plane for 90 degrees: %v", g.plane)
+	}
+
+	for _, line := range []string{"nope", "setpos 100 100", "fov 0", "showRays maybe", "toggle mapMod", "map nope"} {
+		if err := g.exec(line); err == nil {
+			t.Errorf("%q should fail", line)
+		}
+	}
+	if got := g.console.lines[len(g.console.lines)-1]; !strings.HasPrefix(got, "error: ") {
+		t.Errorf("errors should be printed: %q", got)
+	}
+
+	if err := g.exec("map map1"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	if g.mapName != "map1" {
+		t.Errorf("unexpected map: %q", g.mapName)
+	}
+}
+
+func TestConsoleNoclip(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	// Facing the east border, through the pillar in the middle.
+	g.world[2][4].wallType = 1
+	g.moveForward(2)
+	if g.pos.X >= 4 {
+		t.Fatalf("walked into the wall: %v", g.pos)
+	}
+
+	if err := g.exec("noclip"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	g.moveForward(2)
+	if int(g.pos.X) != 4 {
+		t.Fatalf("should walk through the wall: %v", g.pos)
+	}
+	// The borders still hold.
+	g.moveForward(10)
+	if g.pos.X >= 7 {
+		t.Fatalf("walked through the border: %v", g.pos)
+	}
+}
+
+func TestConsoleCompletion(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	for _, tc := range []struct{ input, expect string }{
+		{"setp", "setpos "},
+		{"show", "show"}, // Ambiguous.
+		{"showM", "showMinimapGrid "},
+		{"toggle fo", "toggle fogOfWar "},
+		{"map map", "map map"},
+		{"map map1", "map map1 "},
+		{"xyz", "xyz"},
+	} {
+		g.console.input = tc.input
+		g.complete()
+		if g.console.input != tc.expect {
+			t.Errorf("%q: unexpected completion:\nexpect:\t%q\ngot:\t%q", tc.input, tc.expect, g.console.input)
+		}
+	}
+	if got := g.console.lines[0]; got != "showHighlight  showMinimapGrid  showRays" {
+		t.Errorf("unexpected candidates: %q", got)
+	}
+}
+
+func TestConsoleHistory(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	for _, line := range []string{"showRays 1", "showRays 0", "showRays 0", " "} {
+		g.console.input = line
+		g.submit()
+	}
+	if expect, got := 2, len(g.console.history); expect != got {
+		t.Fatalf("unexpected history size (duplicates and blanks are skipped):\nexpect:\t%d\ngot:\t%d", expect, got)
+	}
+	g.browseHistory(-1)
+	g.browseHistory(-1)
+	g.browseHistory(-1)
+	if g.console.input != "showRays 1" {
+		t.Errorf("unexpected input: %q", g.console.input)
+	}
+	g.browseHistory(1)
+	g.browseHistory(1)
+	if g.console.input != "" {
+		t.Errorf("input should be cleared past the history: %q", g.console.input)
+	}
+}
+
+func TestConsoleScript(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "script.cfg")
+	if err := os.WriteFile(name, []byte("# Comment.\nshowMinimapGrid true\n\nmapMod 2; noclip\nunknown\n"), 0o600); err != nil {
+		t.Fatalf("writeFile: %s", err)
+	}
+	g, _ := newSimGame(t)
+	err := g.exec("exec " + name)
+	if err == nil || !strings.Contains(err.Error(), ":5: unknown command") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !g.showMinimapGrid || g.mapMod != 2 || !g.noclip {
+		t.Errorf("script not run: %t %d %t", g.showMinimapGrid, g.mapMod, g.noclip)
+	}
+}
+
+func TestConsoleScriptRecursion(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "loop.cfg")
+	if err := os.WriteFile(name, []byte("exec "+name+"\n"), 0o600); err != nil {
+		t.Fatalf("writeFile: %s", err)
+	}
+	g, _ := newSimGame(t)
+	err := g.exec("exec " + name)
+	if err == nil || !strings.Contains(err.Error(), "nested too deep") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if g.console.depth != 0 {
+		t.Errorf("depth not restored: %d", g.console.depth)
+	}
+}
+
+func TestConsoleDemo(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	if err := g.startRecording(); err != nil {
+		t.Fatalf("startRecording: %s", err)
+	}
+	pos := g.pos
+	for _, line := range []string{"setpos 1.5 1.5", "map map1", "noclip", "noclip 1", "toggle noclip", "fov 90", "mapMod 2"} {
+		if err := g.exec(line); !errors.Is(err, errDemoRunning) {
+			t.Errorf("[%s] unexpected error: %v", line, err)
+		}
+	}
+	if g.pos != pos || g.noclip || g.mapMod == 2 {
+		t.Errorf("game changed during the demo: %v %t %d", g.pos, g.noclip, g.mapMod)
+	}
+	// The settings outside of the simulation can still change.
+	if err := g.exec("headBob 1; noclip"); !errors.Is(err, errDemoRunning) || !g.effects.headBob {
+		t.Errorf("unexpected result: %v %t", err, g.effects.headBob)
+	}
+}
@@ -23,6 +23,16 @@ type DDA struct {
 	side         bool    // Was a North-South or a East-West wall hit?
 	perpWallDist float64 // Distance from the wall to the camera plane (instead of player to avoid fisheye).
 	realWallDist float64
+
+	// See-through walls crossed by the ray before the opaque wall, nearest first.
+	seeThrough []seeThroughHit
+}
+
+// seeThroughHit is a see-through wall crossed by the ray.
+type seeThroughHit struct {
+	worldPt      image.Point
+	side         bool
+	perpWallDist float64
 }
 
 func newDDA(cameraX float64, pos, dir, plane math2.Point) *DDA {
@@ -71,6 +81,9 @@ func newDDA(cameraX float64, pos, dir, plane math2.Point) *DDA {
 // every jump in their direction,
 // and mapX and mapY get incremented with stepX and stepY respectively.
 //
+// See-through walls don't stop the ray, they are recorded in dda.seeThrough
+// so they can be drawn on top of what is behind them.
+//
 // When the ray has hit a wall, the loop ends,
 // and then we'll know whether an x-side or y-side of
 // a wall was hit in the variable "side",
@@ -79,8 +92,18 @@ func newDDA(cameraX float64, pos, dir, plane math2.Point) *DDA {
 // We won't know exactly where the wall was hit however,
 // but that's not needed in this case because we won't use textured walls for now.
 func (dda *DDA) run(world [][]MapPoint, pos math2.Point) {
-	for dda.worldPt.Y < len(world) && dda.worldPt.X < len(world[dda.worldPt.Y]) { // Sanity checks.
-		if world[dda.worldPt.Y][dda.worldPt.X].wallType != 0 {
+	start := dda.worldPt
+	for dda.worldPt.Y >= 0 && dda.worldPt.Y < len(world) && dda.worldPt.X >= 0 && dda.worldPt.X < len(world[dda.worldPt.Y]) { // Sanity checks.
+		if p := world[dda.worldPt.Y][dda.worldPt.X]; p.seeThrough() {
+			// Ignore the case the player is standing in, it is behind the camera plane.
+			if dda.worldPt != start {
+				dda.seeThrough = append(dda.seeThrough, seeThroughHit{
+					worldPt:      dda.worldPt,
+					side:         dda.side,
+					perpWallDist: dda.wallDist(pos),
+				})
+			}
+		} else if p.wallType != 0 {
 			break
 		}
 		if dda.sideDist.X < dda.sideDist.Y {
@@ -227,10 +250,14 @@ func getStep(rayDir math2.Point) math2.Point {
 // The fisheye effect is an effect you see if you use the real distance,
 // where all the walls become rounded, and can make you sick if you rotate.
 func (dda *DDA) getWallDist(pos math2.Point) {
+	dda.perpWallDist = dda.wallDist(pos)
+	dda.realWallDist = dda.perpWallDist * dda.rayDir.Norm()
+}
+
+// wallDist returns the distance between the current world case and the camera plane.
+func (dda *DDA) wallDist(pos math2.Point) float64 {
 	if dda.side {
-		dda.perpWallDist = (float64(dda.worldPt.Y) - pos.Y + (1-dda.step.Y)/2) / dda.rayDir.Y
-	} else {
-		dda.perpWallDist = (float64(dda.worldPt.X) - pos.X + (1-dda.step.X)/2) / dda.rayDir.X
+		return (float64(dda.worldPt.Y) - pos.Y + (1-dda.step.Y)/2) / dda.rayDir.Y
 	}
-	dda.realWallDist = dda.perpWallDist * dda.rayDir.Norm()
+	return (float64(dda.worldPt.X) - pos.X + (1-dda.step.X)/2) / dda.rayDir.X
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestDDASeeThrough(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap([]byte(`
+1 1 1 1 1 1
+1 0 10 0 18 1
+1 1 1 1 1 1
+`))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+
+	pos := math2.Pt(1.5, 1.5)
+	dda := newDDA(0, pos, math2.Pt(1, 0), math2.Pt(0, 0.66))
+	dda.run(world, pos)
+
+	if expect, got := image.Pt(5, 1), dda.worldPt; expect != got {
+		t.Fatalf("unexpected opaque wall hit:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if expect, got := 2, len(dda.seeThrough); expect != got {
+		t.Fatalf("unexpected see-through hit count:\nexpect:\t%d\ngot:\t%d", expect, got)
+	}
+	for i, expect := range []struct {
+		pt   image.Point
+		dist float64
+	}{
+		{image.Pt(2, 1), 0.5},
+		{image.Pt(4, 1), 2.5},
+	} {
+		if got := dda.seeThrough[i]; got.worldPt != expect.pt || got.perpWallDist != expect.dist {
+			t.Errorf("[%d] unexpected see-through hit:\nexpect:\t%v at %.2f\ngot:\t%v at %.2f", i, expect.pt, expect.dist, got.worldPt, got.perpWallDist)
+		}
+	}
+}
+
+func TestDDAOpenWorld(t *testing.T) {
+	t.Parallel()
+
+	// No border, the rays leave the world on every side.
+	world, err := parseMap([]byte("0 0 0\n0 0 0\n0 0 0\n"))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	pos := math2.Pt(1.5, 1.5)
+	for _, dir := range []math2.Point{math2.Pt(1, 0), math2.Pt(-1, 0), math2.Pt(0, 1), math2.Pt(0, -1), math2.Pt(-1, -1)} {
+		dda := newDDA(0, pos, dir, math2.Pt(0, 0.66))
+		dda.run(world, pos)
+	}
+}
+
+func TestMapPointSolid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		wallType int
+		solid    bool
+	}{
+		{0, false},
+		{1, true},
+		{0xb, true},
+		{wallBars, true},
+		{wallWindow, true},
+		{wallBars | wallPassable, false},
+		{wallFence | wallPassable, false},
+	} {
+		if expect, got := tc.solid, (MapPoint{wallType: tc.wallType}).solid(); expect != got {
+			t.Errorf("unexpected solid value for wall type %#x:\nexpect:\t%t\ngot:\t%t", tc.wallType, expect, got)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Demo file format:
+//   - magic "WOLF3DDEMO", then the uvarint version,
+//   - uvarint length and the starting state, as a save file,
+//   - uvarint number of runs, then each run: uvarint ticks and uvarint actions,
+//   - big endian uint64 checksum of the final state.
+const (
+	demoMagic   = "WOLF3DDEMO"
+	demoVersion = 2 // Bumped on format or checksum changes.
+)
+
+// errDemoRunning is returned when changing the simulation state outside of the steps during a demo.
+var errDemoRunning = errors.New("can't change the game during a demo")
+
+// demo is a recorded sequence of per-tick actions from a starting state.
+type demo struct {
+	state    []byte    // Starting state, as a save file.
+	runs     []demoRun // Actions, run-length encoded.
+	checksum uint64    // Checksum of the final state.
+}
+
+// demoRun is a number of consecutive ticks with the same actions.
+type demoRun struct {
+	ticks   uint64
+	actions actions
+}
+
+// record appends the actions of a tick.
+func (d *demo) record(a actions) {
+	if n := len(d.runs); n > 0 && d.runs[n-1].actions == a {
+		d.runs[n-1].ticks++
+		return
+	}
+	d.runs = append(d.runs, demoRun{ticks: 1, actions: a})
+}
+
+// ticks returns the total number of ticks.
+func (d *demo) ticks() uint64 {
+	var n uint64
+	for _, r := range d.runs {
+		n += r.ticks
+	}
+	return n
+}
+
+// MarshalBinary encodes the demo.
+func (d *demo) MarshalBinary() ([]byte, error) {
+	buf := []byte(demoMagic)
+	buf = binary.AppendUvarint(buf, demoVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(d.state)))
+	buf = append(buf, d.state...)
+	buf = binary.AppendUvarint(buf, uint64(len(d.runs)))
+	for _, r := range d.runs {
+		buf = binary.AppendUvarint(buf, r.ticks)
+		buf = binary.AppendUvarint(buf, uint64(r.actions))
+	}
+	return binary.BigEndian.AppendUint64(buf, d.checksum), nil
+}
+
+// UnmarshalBinary decodes the demo encoded by MarshalBinary.
+func (d *demo) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(demoMagic)) {
+		return errors.New("not a demo file")
+	}
+	r := bufio.NewReader(bytes.NewReader(data[len(demoMagic):]))
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("read version: %w", err)
+	}
+	if version != demoVersion {
+		return fmt.Errorf("unsupported demo version %d, expected %d", version, demoVersion)
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("read state length: %w", err)
+	}
+	if n > uint64(len(data)) {
+		return fmt.Errorf("invalid state length %d", n)
+	}
+	state := make([]byte, n)
+	if _, err := io.ReadFull(r, state); err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+
+	if n, err = binary.ReadUvarint(r); err != nil {
+		return fmt.Errorf("read run count: %w", err)
+	}
+	if n > uint64(len(data)) {
+		return fmt.Errorf("invalid run count %d", n)
+	}
+	runs := make([]demoRun, n)
+	for i := range runs {
+		if runs[i].ticks, err = binary.ReadUvarint(r); err != nil {
+			return fmt.Errorf("read run %d: %w", i, err)
+		}
+		a, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("read run %d: %w", i, err)
+		}
+		runs[i].actions = actions(a)
+	}
+
+	var checksum uint64
+	if err := binary.Read(r, binary.BigEndian, &checksum); err != nil {
+		return fmt.Errorf("read checksum: %w", err)
+	}
+	*d = demo{state: state, runs: runs, checksum: checksum}
+	return nil
+}
+
+// demoPlayer iterates over the actions of a demo.
+type demoPlayer struct {
+	demo *demo
+	run  int    // Current run.
+	tick uint64 // Tick in the current run.
+}
+
+// next returns the actions of the next tick, false when the demo is over.
+func (p *demoPlayer) next() (actions, bool) {
+	for p.run < len(p.demo.runs) && p.tick >= p.demo.runs[p.run].ticks {
+		p.run, p.tick = p.run+1, 0
+	}
+	if p.run >= len(p.demo.runs) {
+		return 0, false
+	}
+	p.tick++
+	return p.demo.runs[p.run].actions, true
+}
+
+// checksum hashes the simulation state: map, position, view, toggles,
+// changes of the level while playing, stats and campaign progress.
+func (g *Game) checksum() uint64 {
+	h := fnv.New64a()
+	writeFloats := func(vals ...float64) {
+		for _, v := range vals {
+			_ = binary.Write(h, binary.BigEndian, math.Float64bits(v)) // Can't fail.
+		}
+	}
+	writeInts := func(vals ...int) {
+		for _, v := range vals {
+			_ = binary.Write(h, binary.BigEndian, int64(v)) // Can't fail.
+		}
+	}
+	writeStats := func(s levelStats) {
+		writeInts(int(s.Ticks), s.Kills, s.Secrets, s.Treasures, s.TotalKills, s.TotalSecrets, s.TotalTreasures)
+	}
+
+	_, _ = io.WriteString(h, g.mapName) // Can't fail.
+	writeFloats(g.pos.X, g.pos.Y, g.dir.X, g.dir.Y, g.plane.X, g.plane.Y)
+	writeFloats(g.pitch, g.jumpZ, g.jumpVel, g.crouchZ)
+	for _, b := range []bool{g.showRays, g.showHighlight, g.showMinimapGrid, g.hideInvisibleWalls, g.fogOfWar} {
+		_ = binary.Write(h, binary.BigEndian, b) // Can't fail.
+	}
+	writeInts(g.mapMod, g.minimapZoom)
+
+	// Level changes: opened doors, picked up objects and fired triggers.
+	for _, line := range g.world {
+		for _, p := range line {
+			writeInts(p.wallType)
+		}
+	}
+	for _, obj := range g.objects {
+		_, _ = io.WriteString(h, obj.kind+"\x00") // Can't fail.
+		writeFloats(obj.pos.X, obj.pos.Y)
+	}
+	for _, st := range g.triggers {
+		_ = binary.Write(h, binary.BigEndian, []bool{st.inside, st.done}) // Can't fail.
+	}
+
+	writeStats(g.stats)
+	if c := g.campaign; c != nil {
+		writeInts(c.Episode, c.Level)
+		writeStats(c.Total)
+		_ = binary.Write(h, binary.BigEndian, c.Intermission) // Can't fail.
+	}
+	return h.Sum64()
+}
+
+// inDemo returns true while recording or playing a demo,
+// when the simulation state must only change in the steps.
+func (g *Game) inDemo() bool {
+	return g.recording != nil || g.playback != nil
+}
+
+// startRecording starts recording the actions from the current state.
+func (g *Game) startRecording() error {
+	state, err := g.marshalState()
+	if err != nil {
+		return err
+	}
+	g.recording = &demo{state: state}
+	return nil
+}
+
+// stopRecording ends the recording and returns the demo.
+func (g *Game) stopRecording() *demo {
+	d := g.recording
+	g.recording = nil
+	if d != nil {
+		d.checksum = g.checksum()
+	}
+	return d
+}
+
+// startPlayback restores the starting state of the demo and replaces the player inputs by the demo actions.
+func (g *Game) startPlayback(d *demo) error {
+	if err := g.unmarshalState(d.state); err != nil {
+		return fmt.Errorf("unmarshalState: %w", err)
+	}
+	g.pending = 0
+	g.playback = &demoPlayer{demo: d}
+	return nil
+}
+
+// playDemo runs the whole demo as fast as possible.
+func (g *Game) playDemo(d *demo) error {
+	if err := g.startPlayback(d); err != nil {
+		return err
+	}
+	for g.playback != nil {
+		a, ok := g.playback.next()
+		if !ok {
+			g.playback = nil
+			break
+		}
+		if err := g.step(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toggleRecording starts or stops the recording, saving the demo.
+func (g *Game) toggleRecording() error {
+	if g.recording == nil {
+		if err := g.startRecording(); err != nil {
+			return err
+		}
+		g.message = "Recording demo"
+		return nil
+	}
+	buf, err := g.stopRecording().MarshalBinary()
+	if err != nil {
+		return err
+	}
+	name := "demos/" + time.Now().Format("20060102-150405") + ".demo"
+	if err := saveFile(name, buf); err != nil {
+		return fmt.Errorf("saveFile %q: %w", name, err)
+	}
+	g.message = "Saved " + name
+	return nil
+}
+
+// cmdDemo plays a demo, either in the window or headless.
+func cmdDemo(args []string) error {
+	fs := flag.NewFlagSet("demo", flag.ContinueOnError)
+	headless := fs.Bool("headless", false, "Play the demo without window and print the final state.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: demo [flags] <demo file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing demo file")
+	}
+
+	buf, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("readFile: %w", err)
+	}
+	d := &demo{}
+	if err := d.UnmarshalBinary(buf); err != nil {
+		return fmt.Errorf("unmarshalBinary: %w", err)
+	}
+
+	if !*headless {
+		g, err := newGame()
+		if err != nil {
+			return err
+		}
+		if err := g.startPlayback(d); err != nil {
+			return err
+		}
+		return runGame(g)
+	}
+
+	g := &Game{}
+	if err := g.playDemo(d); err != nil {
+		return fmt.Errorf("playDemo: %w", err)
+	}
+	checksum := g.checksum()
+	fmt.Printf("map %s ticks %d pos %#v dir %#v checksum %016x\n", g.mapName, d.ticks(), g.pos, g.dir, checksum)
+	if checksum != d.checksum {
+		return fmt.Errorf("checksum mismatch: recorded %016x, got %016x", d.checksum, checksum)
+	}
+	return nil
+}
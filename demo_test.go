@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordTestDemo records a demo on the given embedded map.
+func recordTestDemo(t *testing.T, mapName string) (*demo, *Game) {
+	t.Helper()
+
+	g := &Game{minimapZoom: 16}
+	if err := g.loadMap(mapName); err != nil {
+		t.Fatalf("loadMap: %s", err)
+	}
+	if err := g.startRecording(); err != nil {
+		t.Fatalf("startRecording: %s", err)
+	}
+	for _, r := range []demoRun{
+		{30, actForward},
+		{20, actTurnLeft | actForward},
+		{1, actToggleGrid | actCycleMinimap},
+		{40, actStrafeRight},
+		{15, actBackward | actTurnRight},
+		{60, actForward},
+	} {
+		for i := uint64(0); i < r.ticks; i++ {
+			if err := g.step(r.actions); err != nil {
+				t.Fatalf("step: %s", err)
+			}
+		}
+	}
+	return g.stopRecording(), g
+}
+
+func TestDemoPlayback(t *testing.T) {
+	t.Parallel()
+
+	d, g := recordTestDemo(t, "maps/map1")
+	if expect, got := 6, len(d.runs); expect != got {
+		t.Errorf("unexpected runs count:\nexpect:\t%d\ngot:\t%d", expect, got)
+	}
+
+	buf, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshalBinary: %s", err)
+	}
+	d2 := &demo{}
+	if err := d2.UnmarshalBinary(buf); err != nil {
+		t.Fatalf("unmarshalBinary: %s", err)
+	}
+
+	g2 := &Game{}
+	if err := g2.playDemo(d2); err != nil {
+		t.Fatalf("playDemo: %s", err)
+	}
+	if g.pos != g2.pos || g.dir != g2.dir || !g2.showMinimapGrid || g2.mapMod != 1 {
+		t.Errorf("unexpected state after playback:\nexpect:\t%#v %#v\ngot:\t%#v %#v", g.pos, g.dir, g2.pos, g2.dir)
+	}
+	if d2.checksum != g2.checksum() {
+		t.Errorf("checksum mismatch: %016x %016x", d2.checksum, g2.checksum())
+	}
+
+	// Corrupted files.
+	for name, data := range map[string][]byte{
+		"magic":     append([]byte("NOTADEMO"), buf[10:]...),
+		"truncated": buf[:len(buf)-4],
+		"version":   append([]byte(demoMagic+"\x63"), buf[len(demoMagic)+1:]...),
+	} {
+		if err := (&demo{}).UnmarshalBinary(data); err == nil {
+			t.Errorf("[%s] expected an error", name)
+		}
+	}
+}
+
+func TestDemoChecksum(t *testing.T) {
+	t.Parallel()
+
+	newGame := func() *Game {
+		g := &Game{}
+		if err := g.loadMap("maps/map1"); err != nil {
+			t.Fatalf("loadMap: %s", err)
+		}
+		g.campaign = &campaignProgress{}
+		return g
+	}
+	base := newGame().checksum()
+	for name, change := range map[string]func(g *Game){
+		"pitch":    func(g *Game) { g.pitch = 0.1 },
+		"jump":     func(g *Game) { g.jumpZ, g.jumpVel = 0.1, 1 },
+		"crouch":   func(g *Game) { g.crouchZ = 0.1 },
+		"world":    func(g *Game) { g.world[1][1].wallType = 2 },
+		"objects":  func(g *Game) { g.removeObject(0) },
+		"triggers": func(g *Game) { g.triggers[0].done = true },
+		"stats":    func(g *Game) { g.stats.Treasures++ },
+		"campaign": func(g *Game) { g.campaign.Level++ },
+		"total":    func(g *Game) { g.campaign.Total.Kills++ },
+	} {
+		g := newGame()
+		change(g)
+		if g.checksum() == base {
+			t.Errorf("[%s] change not in the checksum", name)
+		}
+	}
+}
+
+func TestDemoQuickLoad(t *testing.T) {
+	t.Parallel()
+
+	g := &Game{}
+	if err := g.loadMap("maps/map1"); err != nil {
+		t.Fatalf("loadMap: %s", err)
+	}
+	if err := g.startRecording(); err != nil {
+		t.Fatalf("startRecording: %s", err)
+	}
+	// The demo can't replay the load.
+	pos := g.pos
+	if err := g.quickLoad(1); err == nil {
+		t.Fatal("quick load while recording should fail")
+	}
+	if g.recording == nil || g.pos != pos {
+		t.Fatalf("recording changed by the refused load: %v %v", g.recording, g.pos)
+	}
+}
+
+func TestDemoDrivesAdvance(t *testing.T) {
+	t.Parallel()
+
+	d, g := recordTestDemo(t, "maps/map1")
+
+	// Playing through advance, ignoring the player inputs.
+	g2, now := newSimGame(t)
+	if err := g2.startPlayback(d); err != nil {
+		t.Fatalf("startPlayback: %s", err)
+	}
+	g2.last = *now
+	for g2.playback != nil {
+		*now = now.Add(tickDuration)
+		if _, err := g2.advance(actBackward); err != nil {
+			t.Fatalf("advance: %s", err)
+		}
+	}
+	if g.pos != g2.pos || g.dir != g2.dir {
+		t.Errorf("unexpected state after playback:\nexpect:\t%#v %#v\ngot:\t%#v %#v", g.pos, g.dir, g2.pos, g2.dir)
+	}
+}
+
+// TestDemoRegression plays the recorded demos, checking the final state didn't change.
+// Run with UPDATE_DEMOS=1 to record the test demo again when the simulation changes on purpose.
+func TestDemoRegression(t *testing.T) {
+	t.Parallel()
+
+	if os.Getenv("UPDATE_DEMOS") != "" {
+		d, _ := recordTestDemo(t, "maps/map1")
+		buf, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatalf("marshalBinary: %s", err)
+		}
+		if err := os.WriteFile("testdata/map1.demo", buf, 0o600); err != nil {
+			t.Fatalf("writeFile: %s", err)
+		}
+	}
+
+	files, err := filepath.Glob("testdata/*.demo")
+	if err != nil {
+		t.Fatalf("glob: %s", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no demo found")
+	}
+	for _, name := range files {
+		if err := cmdDemo([]string{"-headless", name}); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"image"
 	"image/color"
 	"runtime"
 	"time"
@@ -12,121 +13,230 @@ import (
 )
 
 // Layout implements ebiten.
-func (g Game) Layout(_, _ int) (w, h int) {
-	return g.width, g.height
+func (g *Game) Layout(_, _ int) (w, h int) {
+	return g.screenSize()
 }
 
 // Draw implements ebiten.
 func (g *Game) Draw(screen *ebiten.Image) {
 	screen.Fill(color.Black)
-	img := ebiten.NewImageFromImage(g.frame())
-
-	if g.mapMod != -1 {
-		scale := 0.2
-		if g.mapMod == 1 {
-			scale = 1.0
-		}
+	screenWidth, screenHeight := g.screenSize()
+
+	renderStart := time.Now()
+	start := g.profiler.now()
+	frame := g.frame()
+	if g.profiler != nil {
+		// The frame includes the floor/ceiling, already measured.
+		g.profiler.current.raycast = g.profiler.since(start) - g.profiler.current.background
+	}
+	renderTime := time.Since(renderStart)
+
+	rgba, _ := frame.(*image.RGBA) // Always RGBA.
+	rgba = g.applyEffects(rgba)
+	g.effects.last = rgba
+
+	// Upscale the frame to the screen, the HUD being drawn at the screen resolution.
+	start = g.profiler.now()
+	frameImg := ebiten.NewImageFromImage(rgba)
+	op := &ebiten.DrawImageOptions{Filter: g.renderFilter}
+	op.GeoM.Scale(float64(screenWidth)/float64(g.width), float64(screenHeight)/float64(g.height))
+	dx, _ := g.viewOffset()
+	op.GeoM.Translate(dx*float64(screenHeight), 0)
+	screen.DrawImage(frameImg, op)
+	upload := g.profiler.since(start)
+
+	start = g.profiler.now()
+	switch g.mapMod {
+	case -1: // Hidden.
+	case 2:
+		minimapImg := ebiten.NewImageFromImage(g.rotatingMinimap(screenHeight / 3))
 
-		minimapImg := ebiten.NewImageFromImage(g.minimap(int(float64(img.Bounds().Dx())*scale), int(float64(img.Bounds().Dy())*scale)))
+		opMinimap := &ebiten.DrawImageOptions{}
+		opMinimap.GeoM.Translate(float64(screenWidth)-float64(minimapImg.Bounds().Dx()), 0)
+		screen.DrawImage(minimapImg, opMinimap)
+	default:
+		minimapImg := ebiten.NewImageFromImage(g.minimap(g.minimapBox(screenWidth, screenHeight)))
 
 		opMinimap := &ebiten.DrawImageOptions{}
-		opMinimap.GeoM.Translate(float64(g.width)-float64(minimapImg.Bounds().Dx()), 0)
-		img.DrawImage(minimapImg, opMinimap)
+		opMinimap.GeoM.Translate(float64(screenWidth)-float64(minimapImg.Bounds().Dx()), 0)
+		screen.DrawImage(minimapImg, opMinimap)
+	}
+	if g.profiler != nil {
+		g.profiler.current.minimap = g.profiler.since(start)
 	}
 
-	ebitenutil.DebugPrint(img, fmt.Sprintf(`TPS: %0.2f, FPS: %0.2f
-Resolution: %dx%d
+	dynamic := ""
+	if g.dynamicRes.enabled {
+		dynamic = ", dynamic"
+	}
+	ebitenutil.DebugPrint(screen, fmt.Sprintf(`TPS: %0.2f, FPS: %0.2f
+Resolution: %dx%d (%.0f%%%s)
 Map: %s
 
 Controls:
   A/D: strafe
   W/S: move
   Left/Right: turn
+  PageUp/PageDown/End: Look up/down/center
+  Space/Left Ctrl: Jump/crouch
+  Enter: Use, attack
   M: Cycle minimap mode
-  C: Cycle maps
+  +/-: Zoom rotating minimap
+  C: Skip level
   H: Toggle player highlight
   R: Toggle rays
   G: Toggle grid
   I: Toggle wall visibility
-`, ebiten.ActualTPS(), ebiten.ActualFPS(), g.width, g.height, g.mapName))
+  F: Toggle fog of war
+  E: Toggle map editor
+  F5/F9: Quick save/load, F6/F7: Select slot (%d)
+  F10: Start/stop demo recording
+  F12: Screenshot, F11: Start/stop GIF capture
+  P: Toggle frame time profiler
+  Backquote: Toggle console
+%s
+`, ebiten.ActualTPS(), ebiten.ActualFPS(), g.width, g.height, g.renderScaleValue()*100, dynamic, g.mapName, g.saveSlot, g.message))
+
+	if g.editor.enabled {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf(`Editor: wall type %#x, %dx%d %s
+  Left/Right click: paint/erase
+  [/]: Select wall type
+  Ctrl+Z/Ctrl+Y: Undo/redo
+  Ctrl+Arrows: Resize map
+  Ctrl+S: Save
+`, g.editor.wallType, len(g.world[0]), len(g.world), g.editor.status), 0, screenHeight-6*16)
+	}
+
+	g.drawIntermission(screen)
+	g.drawConsole(screen)
 
-	op := &ebiten.DrawImageOptions{}
-	screen.DrawImage(img, op)
+	if g.profiler != nil {
+		g.profiler.current.upload = upload
+		g.profiler.record()
+		g.profiler.draw(screen)
+	}
+	g.adjustResolution(renderTime)
+	g.captureScreen(screen)
 }
 
 // Update implements ebiten.
 func (g *Game) Update() error {
+	if g.updateConsole() {
+		// Keep the simulation running, without the player inputs.
+		if _, err := g.advance(0); err != nil {
+			return fmt.Errorf("advance: %w", err)
+		}
+		return nil
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyQ) {
 		if runtime.GOOS != "js" {
 			return fmt.Errorf("exit")
 		}
 	}
 
-	dt := time.Since(g.last).Seconds()
-	g.last = time.Now()
-
-	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
-		g.showMinimapGrid = !g.showMinimapGrid
-	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyI) {
-		g.hideInvisibleWalls = !g.hideInvisibleWalls
+	if g.updateEditor() {
+		// Keep the simulation running, without the player inputs.
+		if _, err := g.advance(0); err != nil {
+			return fmt.Errorf("advance: %w", err)
+		}
+		return nil
 	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
-		g.showRays = !g.showRays
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF6) {
+		g.saveSlot = (g.saveSlot+saveMaxSlots-2)%saveMaxSlots + 1
 	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyH) {
-		g.showHighlight = !g.showHighlight
+	if inpututil.IsKeyJustPressed(ebiten.KeyF7) {
+		g.saveSlot = g.saveSlot%saveMaxSlots + 1
 	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyM) {
-		switch g.mapMod {
-		case -1:
-			g.mapMod = 0
-		case 0:
-			g.mapMod = 1
-		case 1:
-			g.mapMod = -1
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+		g.message = fmt.Sprintf("Saved in slot %d", g.saveSlot)
+		if err := g.quickSave(g.saveSlot); err != nil {
+			g.message = err.Error()
 		}
 	}
-	if inpututil.IsKeyJustPressed(ebiten.KeyC) {
-		entries, err := mapData.ReadDir("maps")
-		if err != nil {
-			return fmt.Errorf("readDir: %w", err)
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		if g.profiler == nil {
+			g.profiler = &profiler{}
+		} else {
+			g.profiler = nil
 		}
-		i := -1
-		for ii, elem := range entries {
-			if elem.Name() == g.mapName {
-				i = ii
-				break
-			}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF10) {
+		if err := g.toggleRecording(); err != nil {
+			g.message = err.Error()
 		}
-		if err := g.loadMap("maps/" + entries[(i+1)%len(entries)].Name()); err != nil {
-			return fmt.Errorf("loadMap: %w", err)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		g.takeScreenshot()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) {
+		if err := g.toggleCapture(); err != nil {
+			g.message = err.Error()
 		}
 	}
-
-	if ebiten.IsKeyPressed(ebiten.KeyUp) || ebiten.IsKeyPressed(ebiten.KeyW) {
-		g.moveForward(3.5 * dt)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		g.message = fmt.Sprintf("Loaded slot %d", g.saveSlot)
+		if err := g.quickLoad(g.saveSlot); err != nil {
+			g.message = err.Error()
+		}
 	}
-
-	if ebiten.IsKeyPressed(ebiten.KeyA) {
-		g.moveLeft(3.5 * dt)
+	g.updateMouseLook()
+	if g.net != nil {
+		return g.updateNet(sampleInput())
 	}
-
-	if ebiten.IsKeyPressed(ebiten.KeyDown) || ebiten.IsKeyPressed(ebiten.KeyS) {
-		g.moveBackwards(3.5 * dt)
+	if _, err := g.advance(sampleInput()); err != nil {
+		return fmt.Errorf("advance: %w", err)
 	}
 
-	if ebiten.IsKeyPressed(ebiten.KeyD) {
-		g.moveRight(3.5 * dt)
-	}
+	return nil
+}
 
-	if ebiten.IsKeyPressed(ebiten.KeyRight) {
-		g.turnRight(1.2 * dt)
+// sampleInput returns the actions from the keyboard.
+func sampleInput() actions {
+	var a actions
+	for _, k := range []struct {
+		key    ebiten.Key
+		action actions
+	}{
+		{ebiten.KeyW, actForward},
+		{ebiten.KeyUp, actForward},
+		{ebiten.KeyS, actBackward},
+		{ebiten.KeyDown, actBackward},
+		{ebiten.KeyA, actStrafeLeft},
+		{ebiten.KeyD, actStrafeRight},
+		{ebiten.KeyLeft, actTurnLeft},
+		{ebiten.KeyRight, actTurnRight},
+		{ebiten.KeyPageUp, actLookUp},
+		{ebiten.KeyPageDown, actLookDown},
+		{ebiten.KeyControlLeft, actCrouch},
+	} {
+		if ebiten.IsKeyPressed(k.key) {
+			a |= k.action
+		}
 	}
-
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-		g.turnLeft(1.2 * dt)
+	for _, k := range []struct {
+		key    ebiten.Key
+		action actions
+	}{
+		{ebiten.KeyG, actToggleGrid},
+		{ebiten.KeyI, actToggleInvisibleWalls},
+		{ebiten.KeyF, actToggleFog},
+		{ebiten.KeyR, actToggleRays},
+		{ebiten.KeyH, actToggleHighlight},
+		{ebiten.KeyM, actCycleMinimap},
+		{ebiten.KeyEqual, actZoomIn},
+		{ebiten.KeyKPAdd, actZoomIn},
+		{ebiten.KeyMinus, actZoomOut},
+		{ebiten.KeyKPSubtract, actZoomOut},
+		{ebiten.KeyC, actNextMap},
+		{ebiten.KeySpace, actJump},
+		{ebiten.KeyEnd, actCenterView},
+		{ebiten.KeyEnter, actUse},
+	} {
+		if inpututil.IsKeyJustPressed(k.key) {
+			a |= k.action
+		}
 	}
-
-	return nil
+	return a
 }
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"path"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Editor limits.
+const (
+	editorMinSize = 3
+	editorHistory = 256 // Maximum number of undo steps.
+)
+
+// editor is the in-game map editor state.
+type editor struct {
+	enabled  bool
+	wallType int // Wall type used to paint.
+
+	stroke     *editorEdit // Edit in progress, while the mouse button is held.
+	undo, redo []*editorEdit
+	status     string // Last action result, displayed in the HUD.
+}
+
+// editorEdit is an undoable change of the level.
+// Painting records the changed cases, resizing the whole level.
+type editorEdit struct {
+	cells         map[image.Point][2]MapPoint // Before/after.
+	before, after *level
+}
+
+// editorWallTypes returns the wall types that can be painted, in cycling order.
+func editorWallTypes() []int {
+	return []int{
+		1, 2, 3, 4, 5, 6, 7,
+		wallBars, wallFence, wallWindow,
+		wallBars | wallPassable, wallFence | wallPassable, wallWindow | wallPassable,
+	}
+}
+
+// editorPaint sets the wall type of the given case as part of the current stroke.
+// The edits go to the level, and to the played world.
+func (g *Game) editorPaint(pt image.Point, wallType int) {
+	world := g.lvl.world
+	if pt.Y < 0 || pt.Y >= len(world) || pt.X < 0 || pt.X >= len(world[pt.Y]) {
+		return
+	}
+	// The border keeps the rays and the player in the world.
+	if onBorder(world, pt) {
+		g.editor.status = "the map border can't be edited"
+		return
+	}
+	if pt == image.Pt(int(g.pos.X), int(g.pos.Y)) {
+		g.editor.status = "the player case can't be edited"
+		return
+	}
+	before := world[pt.Y][pt.X]
+	if before.wallType == wallType && g.world[pt.Y][pt.X] == before {
+		return
+	}
+	after := before
+	after.wallType = wallType
+
+	if g.editor.stroke == nil {
+		g.editor.stroke = &editorEdit{cells: map[image.Point][2]MapPoint{}}
+	}
+	if prev, ok := g.editor.stroke.cells[pt]; ok {
+		before = prev[0]
+	}
+	g.editor.stroke.cells[pt] = [2]MapPoint{before, after}
+	world[pt.Y][pt.X] = after
+	g.world[pt.Y][pt.X] = after
+}
+
+// editorEndStroke commits the current stroke to the history.
+func (g *Game) editorEndStroke() {
+	if g.editor.stroke == nil {
+		return
+	}
+	g.editorPush(g.editor.stroke)
+	g.editor.stroke = nil
+}
+
+func (g *Game) editorPush(e *editorEdit) {
+	g.editor.undo = append(g.editor.undo, e)
+	if len(g.editor.undo) > editorHistory {
+		g.editor.undo = g.editor.undo[1:]
+	}
+	g.editor.redo = nil
+}
+
+// editorUndo reverts the last edit.
+func (g *Game) editorUndo() bool {
+	g.editorEndStroke()
+	if len(g.editor.undo) == 0 {
+		return false
+	}
+	e := g.editor.undo[len(g.editor.undo)-1]
+	g.editor.undo = g.editor.undo[:len(g.editor.undo)-1]
+	g.editorApply(e, 0)
+	g.editor.redo = append(g.editor.redo, e)
+	return true
+}
+
+// editorRedo re-applies the last reverted edit.
+func (g *Game) editorRedo() bool {
+	g.editorEndStroke()
+	if len(g.editor.redo) == 0 {
+		return false
+	}
+	e := g.editor.redo[len(g.editor.redo)-1]
+	g.editor.redo = g.editor.redo[:len(g.editor.redo)-1]
+	g.editorApply(e, 1)
+	g.editor.undo = append(g.editor.undo, e)
+	return true
+}
+
+// editorApply sets the world to the before (0) or after (1) state of the edit.
+func (g *Game) editorApply(e *editorEdit, state int) {
+	if e.cells == nil {
+		g.setLevelSize([...]*level{e.before, e.after}[state])
+		return
+	}
+	for pt, cell := range e.cells {
+		g.lvl.world[pt.Y][pt.X] = cell[state]
+		g.world[pt.Y][pt.X] = cell[state]
+	}
+}
+
+// editorResize changes the size of the world.
+// Existing cases are kept, new ones are solid walls to keep the map closed.
+func (g *Game) editorResize(width, height int) bool {
+	g.editorEndStroke()
+	if width < editorMinSize || height < editorMinSize {
+		return false
+	}
+
+	world := make([][]MapPoint, height)
+	for y := range world {
+		world[y] = make([]MapPoint, width)
+		for x := range world[y] {
+			if y < len(g.lvl.world) && x < len(g.lvl.world[y]) {
+				world[y][x] = g.lvl.world[y][x]
+			} else {
+				world[y][x] = MapPoint{Point: math2.Pt(x, y), wallType: 1}
+			}
+			// Close the new border.
+			if p := &world[y][x]; onBorder(world, image.Pt(x, y)) && (!p.solid() || p.seeThrough()) {
+				p.wallType = 1
+			}
+		}
+	}
+	before, after := *g.lvl, g.fitLevel(world)
+	e := &editorEdit{before: &before, after: after}
+	g.setLevelSize(after)
+	g.editorPush(e)
+	return true
+}
+
+// onBorder returns true if the case is on the outer ring of the world.
+func onBorder(world [][]MapPoint, pt image.Point) bool {
+	return pt.X == 0 || pt.Y == 0 || pt.Y == len(world)-1 || pt.X == len(world[pt.Y])-1
+}
+
+// insideWorld returns true if the position is in a case of the world, the border excluded.
+func insideWorld(world [][]MapPoint, pos math2.Point) bool {
+	pt := image.Pt(int(pos.X), int(pos.Y))
+	return pos.X >= 0 && pos.Y >= 0 && pt.Y < len(world) && pt.X < len(world[pt.Y]) && !onBorder(world, pt)
+}
+
+// fitLevel returns a copy of the level with the resized world.
+// The triggers and objects left out of it are dropped, the spawn is moved inside.
+func (g *Game) fitLevel(world [][]MapPoint) *level {
+	lvl := *g.lvl
+	lvl.world, lvl.triggers, lvl.objects = world, nil, nil
+	for _, t := range g.lvl.triggers {
+		if t, err := lvl.recompileTrigger(t); err == nil {
+			lvl.triggers = append(lvl.triggers, t)
+		}
+	}
+	for _, obj := range g.lvl.objects {
+		if insideWorld(world, obj.pos) {
+			lvl.objects = append(lvl.objects, obj)
+		}
+	}
+	lvl.spawn.X = min(lvl.spawn.X, float64(len(world[0]))-1.5)
+	lvl.spawn.Y = min(lvl.spawn.Y, float64(len(world))-1.5)
+	return &lvl
+}
+
+// setLevelSize replaces the level by a resized one, adjusting the dependent state.
+func (g *Game) setLevelSize(lvl *level) {
+	world := lvl.world
+
+	// Keep the changes made while playing, like the opened doors, inside the new border.
+	played := copyWorld(world)
+	for y := range played {
+		for x := range played[y] {
+			if y >= len(g.world) || x >= len(g.world[y]) || onBorder(played, image.Pt(x, y)) {
+				continue
+			}
+			if p := g.world[y][x]; p != g.lvl.world[y][x] {
+				played[y][x] = p
+			}
+		}
+	}
+	explored := newExploredSet(world)
+	for y := range explored {
+		for x := range explored[y] {
+			explored[y][x] = g.explored.has(x, y)
+		}
+	}
+	var objects []levelObject
+	for _, obj := range g.objects {
+		if insideWorld(world, obj.pos) {
+			objects = append(objects, obj)
+		}
+	}
+	// The triggers kept by the resize keep their state.
+	states := map[string]triggerState{}
+	for i, t := range g.lvl.triggers {
+		if i < len(g.triggers) {
+			states[formatTrigger(t)] = g.triggers[i]
+		}
+	}
+
+	*g.lvl = *lvl
+	g.world, g.explored, g.objects = played, explored, objects
+
+	// Keep the player inside the border.
+	g.pos.X = min(g.pos.X, float64(len(world[0]))-1.5)
+	g.pos.Y = min(g.pos.Y, float64(len(world))-1.5)
+
+	g.resetTriggers()
+	for i, t := range g.lvl.triggers {
+		if st, ok := states[formatTrigger(t)]; ok {
+			g.triggers[i] = st
+		}
+	}
+	// Count what there is to find again, keeping what was found.
+	stats := g.stats
+	g.resetStats()
+	g.stats.Ticks, g.stats.Kills, g.stats.Secrets, g.stats.Treasures = stats.Ticks, stats.Kills, stats.Secrets, stats.Treasures
+}
+
+// editorSave writes the edited level in the map format, without the changes made while playing.
+func (g *Game) editorSave() error {
+	g.editorEndStroke()
+	// Only our format can be written back, other formats get a new file next to the original.
+	name := path.Join("maps", g.mapName)
+	if !isTextLevel(name) {
+		name = name[:len(name)-len(path.Ext(name))]
+	}
+	if err := saveFile(name, formatLevel(g.lvl)); err != nil {
+		return fmt.Errorf("saveFile %q: %w", name, err)
+	}
+	g.editor.status = "saved " + name
+	return nil
+}
+
+// editorCase returns the world case under the screen position, using the full map layout.
+func (g *Game) editorCase(x, y int) (image.Point, bool) {
+	screenWidth, screenHeight := g.screenSize()
+	view, scale := g.minimapView(screenWidth, screenHeight)
+	// The full map is drawn on the top right corner.
+	x -= screenWidth - view.Dx()*scale
+	if x < 0 || y < 0 || x >= view.Dx()*scale || y >= view.Dy()*scale {
+		return image.Point{}, false
+	}
+	return view.Min.Add(image.Pt(x/scale, y/scale)), true
+}
+
+// updateEditor handles the editor inputs.
+// Returns true when the inputs are consumed by the editor, i.e. all of them while it is enabled.
+func (g *Game) updateEditor() bool {
+	if inpututil.IsKeyJustPressed(ebiten.KeyE) && g.lvl != nil {
+		// The edits are outside of the simulation steps.
+		if !g.editor.enabled && g.inDemo() {
+			g.message = errDemoRunning.Error()
+			return false
+		}
+		g.editorEndStroke()
+		g.editor.enabled = !g.editor.enabled
+		if g.editor.enabled {
+			g.mapMod = 1
+			if g.editor.wallType == 0 {
+				g.editor.wallType = 1
+			}
+		}
+	}
+	if !g.editor.enabled {
+		return false
+	}
+
+	// Select the wall type.
+	types := editorWallTypes()
+	cur := 0
+	for i, t := range types {
+		if t == g.editor.wallType {
+			cur = i
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		g.editor.wallType = types[(cur+1)%len(types)]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		g.editor.wallType = types[(cur+len(types)-1)%len(types)]
+	}
+
+	// Paint/erase.
+	if pt, ok := g.editorCase(ebiten.CursorPosition()); ok && g.mapMod == 1 {
+		switch {
+		case ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft):
+			g.editorPaint(pt, g.editor.wallType)
+		case ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight):
+			g.editorPaint(pt, 0)
+		}
+	}
+	if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) || inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonRight) {
+		g.editorEndStroke()
+	}
+
+	if !ebiten.IsKeyPressed(ebiten.KeyControl) && !ebiten.IsKeyPressed(ebiten.KeyMeta) {
+		return true
+	}
+
+	// Shortcuts.
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyZ) && !shift:
+		g.editorUndo()
+	case inpututil.IsKeyJustPressed(ebiten.KeyY), inpututil.IsKeyJustPressed(ebiten.KeyZ) && shift:
+		g.editorRedo()
+	case inpututil.IsKeyJustPressed(ebiten.KeyS):
+		if err := g.editorSave(); err != nil {
+			g.editor.status = err.Error()
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		g.editorResize(len(g.lvl.world[0])+1, len(g.lvl.world))
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		g.editorResize(len(g.lvl.world[0])-1, len(g.lvl.world))
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		g.editorResize(len(g.lvl.world[0]), len(g.lvl.world)+1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		g.editorResize(len(g.lvl.world[0]), len(g.lvl.world)-1)
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestEditor(t *testing.T) {
+	t.Parallel()
+
+	lvl, err := parseLevel([]byte("@spawn 1.5 1.5\n1 1 1 1\n1 0 0 1\n1 1 1 1\n"))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{}
+	g.setLevel("test", lvl)
+
+	assertWorld := func(expect string) {
+		t.Helper()
+		if got := string(formatLevel(g.lvl)); !strings.HasSuffix(got, expect) {
+			t.Fatalf("unexpected world:\nexpect:\t%q\ngot:\t%q", expect, got)
+		}
+	}
+
+	// A stroke is a single undo step, painting twice the same case keeps the original value.
+	g.editorPaint(image.Pt(2, 1), 3)
+	g.editorPaint(image.Pt(2, 1), wallBars)
+	g.editorPaint(image.Pt(0, 0), 0)   // Border, ignored.
+	g.editorPaint(image.Pt(1, 1), 3)   // Player case, ignored.
+	g.editorPaint(image.Pt(10, 10), 3) // Out of the map, ignored.
+	g.editorEndStroke()
+	assertWorld("1 1 1 1\n1 0 10 1\n1 1 1 1\n")
+
+	if !g.editorResize(5, 4) {
+		t.Fatal("resize failed")
+	}
+	assertWorld("1 1 1 1 1\n1 0 10 1 1\n1 1 1 1 1\n1 1 1 1 1\n")
+	if expect, got := math2.Pt(4, 3), g.world[3][4].Point; expect != got {
+		t.Errorf("unexpected case position:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if g.editorResize(2, 4) {
+		t.Error("resize under the minimum size should fail")
+	}
+
+	for _, expect := range []string{"1 1 1 1\n1 0 10 1\n1 1 1 1\n", "1 1 1 1\n1 0 0 1\n1 1 1 1\n"} {
+		if !g.editorUndo() {
+			t.Fatal("undo failed")
+		}
+		assertWorld(expect)
+	}
+	if g.editorUndo() {
+		t.Error("undo with empty history should fail")
+	}
+	if !g.editorRedo() || !g.editorRedo() {
+		t.Fatal("redo failed")
+	}
+	assertWorld("1 1 1 1 1\n1 0 10 1 1\n1 1 1 1 1\n1 1 1 1 1\n")
+
+	// A new edit drops the redo history.
+	g.editorUndo()
+	g.editorPaint(image.Pt(2, 1), 2)
+	g.editorEndStroke()
+	if g.editorRedo() {
+		t.Error("redo after a new edit should fail")
+	}
+	if len(g.explored) != 3 || len(g.explored[0]) != 4 {
+		t.Errorf("explored set not resized: %dx%d", len(g.explored[0]), len(g.explored))
+	}
+
+	// The saved level keeps the directives and parses back.
+	buf := formatLevel(g.lvl)
+	if !strings.HasPrefix(string(buf), "@spawn 1.5 1.5") {
+		t.Errorf("spawn lost:\n%s", buf)
+	}
+	if _, err := parseLevel(buf); err != nil {
+		t.Errorf("parseLevel: %s", err)
+	}
+}
+
+func TestEditorPlayedState(t *testing.T) {
+	t.Parallel()
+
+	src := "@spawn 1.5 1.5 0\n@object treasure 2.5 1.5\n@trigger use 3,1 once door 3 1\n1 1 1 1 1 1\n1 0 0 10 0 1\n1 0 0 0 0 1\n1 1 1 1 1 1\n"
+	lvl, err := parseLevel([]byte(src))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{width: 32, height: 24}
+	g.setLevel("test", lvl)
+
+	// Pick up the treasure and open the bars.
+	g.pos = math2.Pt(2.5, 1.5)
+	g.pickUp()
+	if err := g.runTriggers(true); err != nil {
+		t.Fatalf("runTriggers: %s", err)
+	}
+	if len(g.objects) != 0 || g.world[1][3].wallType != wallBars|wallPassable {
+		t.Fatalf("level not played: %v %v", g.objects, g.world[1][3])
+	}
+	if expect, got := src, string(formatLevel(g.lvl)); expect != got {
+		t.Fatalf("played state in the level:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+
+	// Edits go to both, resizing keeps the played changes.
+	g.editorPaint(image.Pt(1, 2), 2)
+	g.editorEndStroke()
+	if !g.editorResize(5, 4) {
+		t.Fatal("resize failed")
+	}
+	if g.world[2][1].wallType != 2 || g.world[1][3].wallType != wallBars|wallPassable {
+		t.Errorf("unexpected played world: %v", g.world)
+	}
+	if expect, got := "1 1 1 1 1\n1 0 0 10 1\n1 2 0 0 1\n1 1 1 1 1\n", string(formatLevel(g.lvl)); !strings.HasSuffix(got, expect) {
+		t.Errorf("unexpected level world:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+}
+
+func TestEditorBorder(t *testing.T) {
+	t.Parallel()
+
+	lvl, err := parseLevel([]byte("@spawn 4.5 2.5\n1 1 1 1 1 1\n1 0 0 12 0 1\n1 0 0 0 0 1\n1 1 1 1 1 1\n"))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{width: 32, height: 24}
+	g.setLevel("test", lvl)
+
+	// Shrinking turns the old interior into the border, which gets closed.
+	if !g.editorResize(4, 3) {
+		t.Fatal("resize failed")
+	}
+	if expect, got := "1 1 1 1\n1 0 0 1\n1 1 1 1\n", string(formatLevel(g.lvl)); !strings.HasSuffix(got, expect) {
+		t.Fatalf("unexpected world:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+	if expect, got := math2.Pt(2.5, 1.5), g.pos; expect != got {
+		t.Fatalf("player not moved inside the border:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	// Rays in every direction stay in the world.
+	for i := 0; i < 8; i++ {
+		g.dir = math2.Pt(1, 0).Rotate(math2.NewDegAngle(float64(i) * 45))
+		g.updatePlane()
+		_ = g.frame()
+	}
+}
+
+func TestEditorResizeLevel(t *testing.T) {
+	t.Parallel()
+
+	src := "@spawn 4.5 2.5 0\n@object treasure 1.5 1.5\n@object treasure 4.5 1.5\n" +
+		"@trigger enter 1,1 once message hi\n@trigger enter 4,1 message gone\n@trigger use 2,1 door 4 2\n@exit 1,2\n" +
+		"1 1 1 1 1 1\n1 0 0 0 0 1\n1 0 0 0 12 1\n1 1 1 1 1 1\n"
+	lvl, err := parseLevel([]byte(src))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{width: 32, height: 24}
+	g.setLevel("test", lvl)
+	g.triggers[0].done = true
+
+	// Shrinking drops the triggers and objects out of the world.
+	if !g.editorResize(4, 3) {
+		t.Fatal("resize failed")
+	}
+	expect := "@spawn 2.5 1.5 0\n@object treasure 1.5 1.5\n@trigger enter 1,1 once message hi\n@exit 1,2\n1 1 1 1\n1 0 0 1\n1 1 1 1\n"
+	if got := string(formatLevel(g.lvl)); expect != got {
+		t.Fatalf("unexpected level:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+	if len(g.objects) != 1 || len(g.triggers) != 2 || !g.triggers[0].done {
+		t.Fatalf("unexpected game state: %v %v", g.objects, g.triggers)
+	}
+	if expect, got := 1, g.stats.TotalTreasures; expect != got {
+		t.Errorf("unexpected treasure count, expect %d, got %d", expect, got)
+	}
+	walk(t, g, actUse, 1)
+
+	// Undo brings them back in the level.
+	if !g.editorUndo() {
+		t.Fatal("undo failed")
+	}
+	if got := string(formatLevel(g.lvl)); src != got {
+		t.Fatalf("level not restored:\nexpect:\t%q\ngot:\t%q", src, got)
+	}
+	if len(g.triggers) != 4 || !g.triggers[0].done {
+		t.Fatalf("unexpected triggers state: %v", g.triggers)
+	}
+}
+
+func TestEditorCase(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap(bigMap(10))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	g := &Game{width: 640, height: 480, world: world}
+
+	// 48 pixels per case, the map being on the right side.
+	for _, tc := range []struct {
+		x, y int
+		pt   image.Point
+		ok   bool
+	}{
+		{0, 0, image.Point{}, false},
+		{160, 0, image.Pt(0, 0), true},
+		{639, 479, image.Pt(9, 9), true},
+		{160 + 48*3 + 1, 48*2 - 1, image.Pt(3, 1), true},
+	} {
+		pt, ok := g.editorCase(tc.x, tc.y)
+		if pt != tc.pt || ok != tc.ok {
+			t.Errorf("unexpected case for %d/%d:\nexpect:\t%v %t\ngot:\t%v %t", tc.x, tc.y, tc.pt, tc.ok, pt, ok)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Camera effects settings.
+const (
+	bobStride    = 1.2   // Distance walked per head bob cycle, in cases.
+	bobAmplitude = 0.012 // Horizon offset, in screen heights.
+	bobRamp      = 4.0   // Head bob amount change per second when starting/stopping to walk.
+
+	shakeAmplitude = 0.02 // Maximum offset of the screen shake, in screen heights at full intensity.
+
+	flashTicks = tickRate / 4 // Flash duration.
+	flashAlpha = 0.5          // Flash color opacity when it starts.
+	fadeTicks  = tickRate / 2 // Fade duration, half out, half in.
+)
+
+// Flash colors.
+//
+//nolint:gochecknoglobals // Constant colors.
+var (
+	flashDamage = color.RGBA{R: 0xff, A: 0xff}
+	flashPickup = color.RGBA{R: 0xff, G: 0xd0, A: 0xff}
+)
+
+// effects are the optional camera effects layered on top of the renderer.
+type effects struct {
+	headBob, shake, flashes, fades bool // Toggles, all off by default.
+
+	walked float64 // Distance walked, the head bob phase.
+	bob    float64 // Head bob amount, ramping up while walking and down when stopped.
+
+	shakeIntensity float64
+	shakeEnd       uint64 // Tick when the shake stops.
+
+	flashColor color.RGBA
+	flashStart uint64
+	flashing   bool
+
+	fadeStart uint64
+	fadeFrom  *image.RGBA // Last frame before the transition, faded out first.
+	fading    bool
+
+	last *image.RGBA // Last drawn frame.
+}
+
+// stepEffects updates the effects for a tick, walked being the distance walked before the tick.
+func (g *Game) stepEffects(walked, dt float64) {
+	e := &g.effects
+	if e.walked > walked {
+		e.bob = min(1, e.bob+bobRamp*dt)
+	} else {
+		e.bob = max(0, e.bob-bobRamp*dt)
+	}
+	if e.flashing && g.tick-e.flashStart >= flashTicks {
+		e.flashing = false
+	}
+	if e.fading && g.tick-e.fadeStart >= fadeTicks {
+		e.fading, e.fadeFrom = false, nil
+	}
+}
+
+// viewOffset returns the head bob and shake offsets of the view, in screen heights.
+func (g *Game) viewOffset() (dx, dy float64) {
+	e := &g.effects
+	if e.headBob {
+		dy += bobAmplitude * e.bob * math.Sin(e.walked*2*math.Pi/bobStride)
+	}
+	if e.shake && g.tick < e.shakeEnd {
+		// Decaying pseudo random offset, deterministic from the tick.
+		left := float64(e.shakeEnd-g.tick) / tickRate
+		amp := shakeAmplitude * e.shakeIntensity * min(1, left)
+		t := float64(g.tick)
+		dx += amp * math.Sin(t*1.7) * math.Cos(t*0.73)
+		dy += amp * math.Sin(t*1.3+1) * math.Cos(t*0.91)
+	}
+	return dx, dy
+}
+
+// startShake shakes the screen for the given number of seconds, intensity from 0 to 1.
+func (g *Game) startShake(intensity, seconds float64) {
+	g.effects.shakeIntensity = min(1, max(0, intensity))
+	g.effects.shakeEnd = g.tick + uint64(seconds*tickRate)
+}
+
+// startFlash flashes the screen with the given color, i.e. on damage or pickup.
+func (g *Game) startFlash(c color.RGBA) {
+	g.effects.flashColor, g.effects.flashStart, g.effects.flashing = c, g.tick, true
+}
+
+// startFade starts the fade transition, from the given frame of the previous view.
+func (g *Game) startFade(from *image.RGBA) {
+	g.effects.fadeFrom, g.effects.fadeStart, g.effects.fading = from, g.tick, true
+}
+
+// applyEffects post-processes the frame with the enabled flash and fade effects.
+// The returned image can be a different one during the fade out.
+func (g *Game) applyEffects(img *image.RGBA) *image.RGBA {
+	e := &g.effects
+	if e.flashes && e.flashing {
+		t := float64(g.tick-e.flashStart) / flashTicks
+		fadeImage(img, e.flashColor, flashAlpha*(1-t))
+	}
+	if e.fades && e.fading {
+		t := float64(g.tick-e.fadeStart) / fadeTicks
+		if t < 0.5 && e.fadeFrom != nil {
+			// Fade out the previous view.
+			out := image.NewRGBA(e.fadeFrom.Rect)
+			copy(out.Pix, e.fadeFrom.Pix)
+			fadeImage(out, color.RGBA{A: 0xff}, t*2)
+			return out
+		}
+		// Fade in the new one.
+		fadeImage(img, color.RGBA{A: 0xff}, max(0, 1-(t-0.5)*2))
+	}
+	return img
+}
+
+// fadeImage blends the image toward the given color, amount from 0 (unchanged) to 1 (plain color).
+// The alpha channel is left untouched.
+func fadeImage(img *image.RGBA, c color.RGBA, amount float64) {
+	if amount <= 0 {
+		return
+	}
+	amount = min(1, amount)
+	// Fixed point, 8 bits.
+	a := int(amount * 256)
+	r, g, b := int(c.R)*a, int(c.G)*a, int(c.B)*a
+	buffer := img.Pix
+	for i := 0; i+2 < len(buffer); i += 4 {
+		buffer[i] = byte((int(buffer[i])*(256-a) + r) >> 8)
+		buffer[i+1] = byte((int(buffer[i+1])*(256-a) + g) >> 8)
+		buffer[i+2] = byte((int(buffer[i+2])*(256-a) + b) >> 8)
+	}
+}
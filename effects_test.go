@@ -0,0 +1,143 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestFadeImage(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	copy(img.Pix, []byte{200, 100, 0, 7, 0, 0, 0, 7})
+	fadeImage(img, color.RGBA{R: 100, G: 100, B: 100, A: 255}, 0.5)
+	if expect, got := []byte{150, 100, 50, 7, 50, 50, 50, 7}, img.Pix; string(expect) != string(got) {
+		t.Errorf("unexpected pixels:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	fadeImage(img, color.RGBA{R: 10, G: 20, B: 30}, 1)
+	if expect, got := []byte{10, 20, 30, 7, 10, 20, 30, 7}, img.Pix; string(expect) != string(got) {
+		t.Errorf("unexpected pixels:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+}
+
+func TestHeadBob(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	g.effects.headBob = true
+
+	seen := map[bool]bool{}
+	for i := 0; i < tickRate; i++ {
+		if err := g.step(actForward | actTurnLeft); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+		_, dy := g.viewOffset()
+		seen[dy > 0] = true
+	}
+	if !seen[true] || !seen[false] {
+		t.Error("the view should bob up and down while walking")
+	}
+
+	// Stopped, the bob settles.
+	for i := 0; i < tickRate; i++ {
+		if err := g.step(0); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	if _, dy := g.viewOffset(); dy != 0 {
+		t.Errorf("the bob should stop with the player: %f", dy)
+	}
+
+	// Turning on the spot or walking into a wall doesn't bob.
+	g.pos, g.dir = math2.Pt(1.2, 2.5), math2.Pt(1, 0)
+	for i := 0; i < tickRate; i++ {
+		if err := g.step(actTurnLeft); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	g.dir = math2.Pt(1, 0)
+	for i := 0; i < tickRate; i++ {
+		if err := g.step(actBackward); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	if g.effects.bob != 0 {
+		t.Errorf("should not bob against a wall: %f", g.effects.bob)
+	}
+}
+
+func TestMapFade(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	g.width, g.height = 4, 3
+	g.effects.fades = true
+
+	before := image.NewRGBA(image.Rect(0, 0, g.width, g.height))
+	for i := range before.Pix {
+		before.Pix[i] = 200
+	}
+	g.effects.last = before
+	if err := g.step(actNextMap); err != nil {
+		t.Fatalf("step: %s", err)
+	}
+
+	// The previous view fades out, the new one fades in.
+	frame := func() byte {
+		img := image.NewRGBA(image.Rect(0, 0, g.width, g.height))
+		for i := range img.Pix {
+			img.Pix[i] = 100
+		}
+		return g.applyEffects(img).Pix[0]
+	}
+	var got []byte
+	for i := 0; i < fadeTicks+2; i += fadeTicks / 6 {
+		got = append(got, frame())
+		for j := 0; j < fadeTicks/6; j++ {
+			if err := g.step(0); err != nil {
+				t.Fatalf("step: %s", err)
+			}
+		}
+	}
+	if expect := []byte{200, 133, 67, 0, 33, 66, 100}; string(expect) != string(got) {
+		t.Errorf("unexpected fade:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if before.Pix[0] != 200 {
+		t.Error("the previous frame should not be modified")
+	}
+
+	// Disabled.
+	g.effects.fades = false
+	g.startFade(before)
+	if got := frame(); got != 100 {
+		t.Errorf("the fade should be disabled: %d", got)
+	}
+}
+
+func TestFlash(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	g.effects.flashes = true
+	if err := g.exec("flash pickup"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	g.applyEffects(img)
+	if img.Pix[0] != 0x7f || img.Pix[1] != 0x68 || img.Pix[2] != 0 {
+		t.Errorf("unexpected flash color: %v", img.Pix)
+	}
+	for i := 0; i < flashTicks; i++ {
+		if err := g.step(0); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+	img = image.NewRGBA(image.Rect(0, 0, 1, 1))
+	g.applyEffects(img)
+	if img.Pix[0] != 0 {
+		t.Errorf("the flash should be over: %v", img.Pix)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// exploredSet keeps track of the world cases the player has seen.
+type exploredSet [][]bool
+
+func newExploredSet(world [][]MapPoint) exploredSet {
+	e := make(exploredSet, len(world))
+	for y := range world {
+		e[y] = make([]bool, len(world[y]))
+	}
+	return e
+}
+
+// mark the given case as seen. Out of bounds points are ignored.
+func (e exploredSet) mark(pt image.Point) {
+	if pt.Y < 0 || pt.Y >= len(e) || pt.X < 0 || pt.X >= len(e[pt.Y]) {
+		return
+	}
+	e[pt.Y][pt.X] = true
+}
+
+// markRay marks the wall hit by the ray as well as the see-through walls it went through.
+func (e exploredSet) markRay(dda *DDA) {
+	e.mark(dda.worldPt)
+	for _, hit := range dda.seeThrough {
+		e.mark(hit.worldPt)
+	}
+}
+
+func (e exploredSet) has(x, y int) bool {
+	return y >= 0 && y < len(e) && x >= 0 && x < len(e[y]) && e[y][x]
+}
+
+// MarshalText encodes the set as one line per row, '#' for seen cases, '.' otherwise.
+func (e exploredSet) MarshalText() ([]byte, error) {
+	var buf strings.Builder
+	for _, line := range e {
+		for _, seen := range line {
+			if seen {
+				buf.WriteByte('#')
+			} else {
+				buf.WriteByte('.')
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return []byte(buf.String()), nil
+}
+
+// UnmarshalText decodes the set encoded by MarshalText.
+func (e *exploredSet) UnmarshalText(data []byte) error {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	out := make(exploredSet, 0, len(lines))
+	for y, line := range lines {
+		row := make([]bool, len(line))
+		for x, c := range line {
+			switch c {
+			case '#':
+				row[x] = true
+			case '.':
+			default:
+				return fmt.Errorf("invalid explored value %q at %d/%d", c, y, x)
+			}
+		}
+		out = append(out, row)
+	}
+	*e = out
+	return nil
+}
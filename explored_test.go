@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestExploredFrame(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap([]byte(`
+1 1 1 1 1 1 1
+1 0 0 1 0 0 2
+1 1 1 1 1 1 1
+`))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	g := &Game{
+		width:    32,
+		height:   24,
+		world:    world,
+		explored: newExploredSet(world),
+		pos:      math2.Pt(1.5, 1.5),
+		dir:      math2.Pt(1, 0),
+		plane:    math2.Pt(0, 0.66),
+	}
+	_ = g.frame()
+
+	if !g.explored.has(3, 1) {
+		t.Errorf("wall in front of the player should be explored")
+	}
+	if g.explored.has(6, 1) {
+		t.Errorf("wall hidden behind another wall should not be explored")
+	}
+	if g.explored.has(0, 1) {
+		t.Errorf("wall behind the player should not be explored")
+	}
+}
+
+func TestExploredMarshal(t *testing.T) {
+	t.Parallel()
+
+	in := exploredSet{{true, false}, {false, false, true}}
+	buf, err := in.MarshalText()
+	if err != nil {
+		t.Fatalf("marshal: %s", err)
+	}
+	if expect, got := "#.\n..#\n", string(buf); expect != got {
+		t.Fatalf("unexpected encoding:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+
+	var out exploredSet
+	if err := out.UnmarshalText(buf); err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	for y := range in {
+		for x := range in[y] {
+			if in.has(x, y) != out.has(x, y) {
+				t.Errorf("mismatch at %d/%d", x, y)
+			}
+		}
+	}
+
+	if err := out.UnmarshalText([]byte("#x\n")); err == nil {
+		t.Fatal("invalid input should fail")
+	}
+}
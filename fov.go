@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Field of view limits, in degrees.
+const (
+	minFOV = 10.0
+	maxFOV = 170.0
+)
+
+// defaultPlane is the camera plane length of the original raycaster, used when the field of view is not set.
+const defaultPlane = 0.66
+
+// defaultFOV returns the field of view matching the default camera plane, about 66 degrees.
+func defaultFOV() float64 {
+	return 2 * math.Atan(defaultPlane) * 180 / math.Pi
+}
+
+// fovDegrees returns the horizontal field of view.
+func (g *Game) fovDegrees() float64 {
+	if g.fov == 0 {
+		return defaultFOV()
+	}
+	return g.fov
+}
+
+// setFOV changes the horizontal field of view, keeping the position and direction.
+func (g *Game) setFOV(deg float64) error {
+	if deg < minFOV || deg > maxFOV {
+		return fmt.Errorf("fov %g out of range, expect %g to %g degrees", deg, minFOV, maxFOV)
+	}
+	g.fov = deg
+	g.updatePlane()
+	return nil
+}
+
+// updatePlane sets the camera plane perpendicular to the direction,
+// its length being the tangent of half the field of view.
+func (g *Game) updatePlane() {
+	length := defaultPlane
+	if g.fov != 0 {
+		length = math.Tan(g.fov / 2 * math.Pi / 180)
+	}
+	g.plane = math2.Pt(-g.dir.Y, g.dir.X).Scale(length)
+}
+
+// focalLength returns the distance in pixels between the eye and the screen.
+//
+// The field of view is horizontal: the screen width spans the camera plane,
+// and the same scale is used vertically so the walls stay square at any aspect ratio.
+func (g *Game) focalLength() float64 {
+	return float64(g.width) / (2 * g.plane.Norm())
+}
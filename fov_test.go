@@ -0,0 +1,121 @@
+package main
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestSetFOV(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	g.explored = newExploredSet(g.world)
+	g.turnRight(0.3)
+	pos, dir := g.pos, g.dir
+	if err := g.setFOV(120); err != nil {
+		t.Fatalf("setFOV: %s", err)
+	}
+	if g.pos != pos || g.dir != dir {
+		t.Errorf("the position and direction should be kept: %v %v", g.pos, g.dir)
+	}
+	if expect, got := math.Tan(math.Pi/3), g.plane.Norm(); math.Abs(expect-got) > 1e-9 {
+		t.Errorf("unexpected plane length:\nexpect:\t%f\ngot:\t%f", expect, got)
+	}
+	if dot := g.plane.X*g.dir.X + g.plane.Y*g.dir.Y; math.Abs(dot) > 1e-9 {
+		t.Errorf("the plane should be perpendicular to the direction: %v %v", g.plane, g.dir)
+	}
+	for _, fov := range []float64{0, minFOV - 1, maxFOV + 1} {
+		if err := g.setFOV(fov); err == nil {
+			t.Errorf("fov %g should fail", fov)
+		}
+	}
+
+	// Saves keep the field of view.
+	buf, err := g.marshalState()
+	if err != nil {
+		t.Fatalf("marshalState: %s", err)
+	}
+	g2 := &Game{}
+	if err := g2.unmarshalState(buf); err != nil {
+		t.Fatalf("unmarshalState: %s", err)
+	}
+	if math.Abs(g2.fovDegrees()-120) > 1e-9 {
+		t.Errorf("unexpected fov after load: %f", g2.fovDegrees())
+	}
+}
+
+func TestStrafeSpeed(t *testing.T) {
+	t.Parallel()
+
+	for _, fov := range []float64{minFOV, 90, maxFOV} {
+		g, _ := newSimGame(t)
+		g.turnRight(0.3)
+		if err := g.setFOV(fov); err != nil {
+			t.Fatalf("setFOV: %s", err)
+		}
+		pos := g.pos
+		g.moveRight(0.5)
+		if expect, got := 0.5*defaultPlane, g.pos.Magnitude(pos); math.Abs(expect-got) > 1e-9 {
+			t.Errorf("[%g] unexpected strafe distance:\nexpect:\t%f\ngot:\t%f", fov, expect, got)
+		}
+		if dot := (g.pos.X-pos.X)*g.dir.X + (g.pos.Y-pos.Y)*g.dir.Y; math.Abs(dot) > 1e-9 {
+			t.Errorf("[%g] strafe not perpendicular to the direction", fov)
+		}
+	}
+}
+
+func TestSquareWalls(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap(bigMap(8))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	// A 1x1 pillar right in front of the player.
+	world[3][5].wallType = 2
+
+	for _, tc := range []struct {
+		width, height int
+		fov           float64
+	}{
+		{320, 240, 90},
+		{320, 100, 90},
+		{200, 300, 90},
+		{400, 200, 60},
+	} {
+		g := &Game{width: tc.width, height: tc.height, world: world, explored: newExploredSet(world), pos: math2.Pt(2.5, 3.5), dir: math2.Pt(1, 0)}
+		if err := g.setFOV(tc.fov); err != nil {
+			t.Fatalf("setFOV: %s", err)
+		}
+		// Only the pillar texture is colored.
+		for y := range g.texturesCache {
+			for x := 2 * texSize; x < 3*texSize; x++ {
+				g.texturesCache[y][x] = [3]byte{1, 2, 3}
+			}
+		}
+		img, _ := g.frame().(*image.RGBA) // Always RGBA.
+		isPillar := func(x, y int) bool {
+			off := img.PixOffset(x, y)
+			return img.Pix[off] == 1 && img.Pix[off+1] == 2 && img.Pix[off+2] == 3
+		}
+		w, h := 0, 0
+		for x := 0; x < g.width; x++ {
+			if isPillar(x, g.height/2) {
+				w++
+			}
+		}
+		for y := 0; y < g.height; y++ {
+			if isPillar(g.width/2, y) {
+				h++
+			}
+		}
+		// 1 case at 2.5 cases from the eye.
+		expect := int(g.focalLength() / 2.5)
+		if w == 0 || h == 0 || math.Abs(float64(w-h)) > 2 || math.Abs(float64(w-expect)) > 2 {
+			t.Errorf("%dx%d fov %g: the pillar should be square, %d pixels wide: %dx%d", tc.width, tc.height, tc.fov, expect, w, h)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.creack.net/wolf3d/mapgen"
+	"go.creack.net/wolf3d/math2"
+)
+
+// generateLevel creates a random level with the given algorithm.
+func generateLevel(algorithm string, width, height int, seed int64) (*level, error) {
+	m, err := mapgen.Generate(algorithm, width, height, seed)
+	if err != nil {
+		return nil, fmt.Errorf("generate: %w", err)
+	}
+	lvl := &level{
+		world: make([][]MapPoint, height),
+		spawn: math2.Pt(float64(m.Spawn.X)+0.5, float64(m.Spawn.Y)+0.5),
+	}
+	for y, row := range m.Walls {
+		lvl.world[y] = make([]MapPoint, width)
+		for x, wallType := range row {
+			lvl.world[y][x] = MapPoint{Point: math2.Pt(x, y), wallType: wallType}
+		}
+	}
+	return lvl, nil
+}
+
+// cmdGenerate writes a random level in our format.
+func cmdGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	seed := fs.Int64("seed", time.Now().UnixNano(), "Random seed. The same seed generates the same map.")
+	width := fs.Int("width", 32, "Map width.")
+	height := fs.Int("height", 32, "Map height.")
+	out := fs.String("o", "", "Output file, stdout if empty.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: generate [flags] <%s>\n", strings.Join(mapgen.Algorithms(), "|"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing algorithm")
+	}
+
+	lvl, err := generateLevel(fs.Arg(0), *width, *height, *seed)
+	if err != nil {
+		return err
+	}
+	// Keep the parameters in the file to share/regenerate it.
+	buf := append([]byte(fmt.Sprintf("# generate -seed %d -width %d -height %d %s\n", *seed, *width, *height, fs.Arg(0))), formatLevel(lvl)...)
+	if *out == "" {
+		_, err := os.Stdout.Write(buf)
+		return err
+	}
+	if err := os.WriteFile(*out, buf, 0o600); err != nil {
+		return fmt.Errorf("writeFile: %w", err)
+	}
+	return nil
+}
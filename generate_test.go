@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"go.creack.net/wolf3d/mapgen"
+)
+
+func TestGenerateLevel(t *testing.T) {
+	t.Parallel()
+
+	// Generated levels should pass the validation.
+	for _, algorithm := range mapgen.Algorithms() {
+		for seed := int64(0); seed < 5; seed++ {
+			lvl, err := generateLevel(algorithm, 24, 16, seed)
+			if err != nil {
+				t.Fatalf("generateLevel: %s", err)
+			}
+			for _, issue := range validateMap(formatLevel(lvl)) {
+				t.Errorf("[%s %d] invalid level: %s", algorithm, seed, issue)
+			}
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"image/draw"
 	"image/png"
 	"log"
+	"os"
 	"runtime"
 	"time"
 
@@ -26,6 +27,9 @@ var textureData []byte
 //go:embed maps/*
 var mapData embed.FS
 
+//go:embed campaign
+var campaignData []byte
+
 func loadTextures(textureData []byte) (front, side *image.RGBA, err error) {
 	p, err := png.Decode(bytes.NewReader(textureData))
 	if err != nil {
@@ -45,32 +49,47 @@ func loadTextures(textureData []byte) (front, side *image.RGBA, err error) {
 	return front, side, nil
 }
 
-func main() {
-	textures, sideTextures, err := loadTextures(textureData)
-	if err != nil {
-		log.Fatal(err)
+// loadMaskedTextures creates the see-through walls textures
+// by cutting transparent holes in some of the regular textures.
+func loadMaskedTextures(front, side *image.RGBA) (maskedFront, maskedSide *image.RGBA) {
+	masks := []struct {
+		texNum int
+		opaque func(x, y int) bool
+	}{
+		// Bars: vertical stone bars held by top/bottom rails.
+		{texNum: 5, opaque: func(x, y int) bool { return x%16 < 4 || y < 4 || y >= texSize-4 }},
+		// Fence: wooden diagonal lattice in a frame.
+		{texNum: 4, opaque: func(x, y int) bool {
+			return (x+y)%16 < 3 || (x-y+texSize)%16 < 3 || y < 3 || y >= texSize-3
+		}},
+		// Window: wooden frame with a cross in the middle.
+		{texNum: 6, opaque: func(x, y int) bool {
+			return x < 6 || x >= texSize-6 || y < 6 || y >= texSize-6 || (x >= texSize/2-3 && x < texSize/2+3) || (y >= texSize/2-3 && y < texSize/2+3)
+		}},
 	}
-	g := &Game{
-		width:  1280,
-		height: 720,
-
-		textures:     textures,
-		sideTextures: sideTextures,
 
-		dir:   math2.Pt(1, 0),
-		plane: math2.Pt(0, 0.66),
-
-		last: time.Now(),
-
-		showRays: false,
-		mapMod:   0,
-	}
-	if err := g.loadMap("maps/map4"); err != nil {
-		log.Fatal(err)
+	maskedFront = image.NewRGBA(image.Rect(0, 0, texSize*len(masks), texSize))
+	maskedSide = image.NewRGBA(maskedFront.Bounds())
+	for i, m := range masks {
+		for y := 0; y < texSize; y++ {
+			for x := 0; x < texSize; x++ {
+				if !m.opaque(x, y) {
+					continue
+				}
+				maskedFront.Set(i*texSize+x, y, front.At(m.texNum*texSize+x, y))
+				maskedSide.Set(i*texSize+x, y, side.At(m.texNum*texSize+x, y))
+			}
+		}
 	}
+	return maskedFront, maskedSide
+}
+
+// setTextures sets the textures and fills the caches used to render the frames.
+func (g *Game) setTextures(front, side *image.RGBA) {
+	g.textures, g.sideTextures = front, side
 	for y := range g.texturesCache {
 		for x := range g.texturesCache[y] {
-			r1, g1, b1, _ := g.textures.At(x, y).RGBA()
+			r1, g1, b1, _ := front.At(x, y).RGBA()
 			g.texturesCache[y][x][0] = byte(r1)
 			g.texturesCache[y][x][1] = byte(g1)
 			g.texturesCache[y][x][2] = byte(b1)
@@ -79,22 +98,97 @@ func main() {
 
 	for y := range g.sideTexturesCache {
 		for x := range g.sideTexturesCache[y] {
-			r1, g1, b1, _ := g.sideTextures.At(x, y).RGBA()
+			r1, g1, b1, _ := side.At(x, y).RGBA()
 			g.sideTexturesCache[y][x][0] = byte(r1)
 			g.sideTexturesCache[y][x][1] = byte(g1)
 			g.sideTexturesCache[y][x][2] = byte(b1)
 		}
 	}
-	g.triangleImg = ebiten.NewImage(g.width, g.height)
+	maskedTextures, maskedSideTextures := loadMaskedTextures(front, side)
+	for y := range g.maskedTexturesCache {
+		for x := range g.maskedTexturesCache[y] {
+			copy(g.maskedTexturesCache[y][x][:], maskedTextures.Pix[maskedTextures.PixOffset(x, y):])
+			copy(g.maskedSideTexturesCache[y][x][:], maskedSideTextures.Pix[maskedSideTextures.PixOffset(x, y):])
+		}
+	}
+}
+
+// newGame creates the game with the default settings and map.
+func newGame() (*Game, error) {
+	textures, sideTextures, err := loadTextures(textureData)
+	if err != nil {
+		return nil, err
+	}
+	g := &Game{
+		width:  1280,
+		height: 720,
+
+		screenWidth:  1280,
+		screenHeight: 720,
+		renderFilter: ebiten.FilterNearest,
+
+		dir: math2.Pt(1, 0),
+
+		last: time.Now(),
+
+		showRays: false,
+		fogOfWar: true,
+		mapMod:   0,
+
+		minimapZoom: 16,
+
+		saveSlot: 1,
+	}
+	if err := g.startCampaign(0); err != nil {
+		return nil, err
+	}
+	g.setTextures(textures, sideTextures)
+
+	g.triangleImg = ebiten.NewImage(g.screenSize())
 	g.triangleImg.Fill(color.White)
 
-	ebiten.SetWindowSize(g.width*2, g.height*2)
+	g.execStartupScript()
+	return g, nil
+}
+
+// runGame opens the window and runs the game until exit.
+func runGame(g *Game) error {
+	screenWidth, screenHeight := g.screenSize()
+	ebiten.SetWindowSize(screenWidth*2, screenHeight*2)
 	ebiten.SetWindowTitle("Ray casting and shadows (Ebitengine Demo)")
 	if runtime.GOOS != "js" {
 		ebiten.SetFullscreen(true)
 	}
 	println("Starting")
-	if err := ebiten.RunGame(g); err != nil {
+	err := ebiten.RunGame(g)
+	// Don't lose the capture frames still being written.
+	if cerr := g.flushCapture(); cerr != nil {
+		log.Printf("capture: %s", cerr)
+	}
+	return err
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+	// In the browser, the page URL can ask to join a server.
+	if args := browserJoinArgs(); args != nil {
+		if err := cmdJoin(args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	g, err := newGame()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := runGame(g); err != nil {
 		log.Fatal(err)
 	}
 }
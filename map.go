@@ -2,45 +2,70 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
 	"go.creack.net/wolf3d/math2"
 )
 
-func parseMap(mapData []byte) ([][]MapPoint, error) {
-	// Start by cleaning up the input, removing blank lines and dup spaces.
+// mapToken is a single value of a map file with its position.
+type mapToken struct {
+	text      string
+	line, col int // 1-based position in the file.
+}
+
+// tokenizeMap splits the map file in lines of values,
+// skipping blank lines, comments and directives.
+func tokenizeMap(mapData []byte) [][]mapToken {
 	//nolint:prealloc // False positive.
-	var grid [][]string
-	for _, line := range strings.Split(string(mapData), "\n") {
-		if line == "" || line[0] == '#' {
+	var grid [][]mapToken
+	for i, line := range strings.Split(string(mapData), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || line[0] == '#' || line[0] == '@' {
 			continue
 		}
-		var gridLine []string
-		for _, elem := range strings.Split(line, " ") {
-			if elem == "" {
+		var gridLine []mapToken
+		for col := 0; col < len(line); {
+			if line[col] == ' ' || line[col] == '\t' {
+				col++
 				continue
 			}
-			gridLine = append(gridLine, elem)
+			end := col
+			for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+				end++
+			}
+			gridLine = append(gridLine, mapToken{text: line[col:end], line: i + 1, col: col + 1})
+			col = end
+		}
+		if len(gridLine) == 0 {
+			continue
 		}
 		grid = append(grid, gridLine)
 	}
+	return grid
+}
+
+func parseMap(mapData []byte) ([][]MapPoint, error) {
+	// Start by cleaning up the input, removing blank lines and dup spaces.
+	grid := tokenizeMap(mapData)
 
 	// Then for each point, parse the height and optional color.
 	//nolint:prealloc // False positive.
 	var m [][]MapPoint
 	for y, line := range grid {
+		if len(line) != len(grid[0]) {
+			return nil, fmt.Errorf("%d:%d: row has %d cases, expected %d", line[0].line, line[0].col, len(line), len(grid[0]))
+		}
 		var points []MapPoint
 		for x, elem := range line {
-			h, err := strconv.ParseUint(elem, 16, 64)
+			p, err := parseCell(elem.text)
 			if err != nil {
-				return nil, fmt.Errorf("invalid height %q for %d/%d: %w", elem, y, x, err)
-			}
-
-			p := MapPoint{
-				Point:    math2.Pt(x, y),
-				wallType: int(h),
+				return nil, fmt.Errorf("%d:%d: invalid case %q: %w", elem.line, elem.col, elem.text, err)
 			}
+			p.Point = math2.Pt(x, y)
 
 			points = append(points, p)
 		}
@@ -54,9 +79,309 @@ func parseMap(mapData []byte) ([][]MapPoint, error) {
 	return m, nil
 }
 
+// parseCell parses a single case: "<wall>[:<floor>[:<ceiling>]]", all in hex.
+// The floor and ceiling textures can be left empty to use the default ones.
+func parseCell(text string) (MapPoint, error) {
+	var p MapPoint
+
+	parts := strings.SplitN(text, ":", 3)
+	h, err := strconv.ParseUint(parts[0], 16, 64)
+	if err != nil {
+		return p, fmt.Errorf("invalid wall type %q", parts[0])
+	}
+	p.wallType = int(h)
+
+	for i, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		tex, err := strconv.ParseUint(part, 16, 64)
+		if err != nil || tex >= numTextures {
+			return p, fmt.Errorf("invalid %s texture %q", [...]string{"floor", "ceiling"}[i], part)
+		}
+		if i == 0 {
+			p.floor = int(tex) + 1
+		} else {
+			p.ceiling = int(tex) + 1
+		}
+	}
+	return p, nil
+}
+
+// formatCell is the reverse of parseCell.
+func formatCell(p MapPoint) string {
+	out := strconv.FormatInt(int64(p.wallType), 16)
+	if p.floor == 0 && p.ceiling == 0 {
+		return out
+	}
+	out += ":"
+	if p.floor != 0 {
+		out += strconv.FormatInt(int64(p.floor-1), 16)
+	}
+	if p.ceiling != 0 {
+		out += ":" + strconv.FormatInt(int64(p.ceiling-1), 16)
+	}
+	return out
+}
+
+// level is a parsed map file: the world and its metadata.
+type level struct {
+	world [][]MapPoint
+
+	spawn    math2.Point // Player start position.
+	spawnDir math2.Angle // Player start direction, 0 is facing east.
+
+	objects  []levelObject
+	triggers []trigger
+}
+
+// levelObject is an object placed in the level: decoration, item, enemy, etc.
+type levelObject struct {
+	kind  string
+	pos   math2.Point
+	props map[string]string // Free-form properties, kept as-is for the game code.
+}
+
+// parseLevel parses the map file grid and its directives.
+//
+// Directives are lines starting with '@' followed by the directive name and its arguments:
+//
+//	@spawn <x> <y> [angle]: Player start position and direction in degrees.
+//	                        Defaults to the middle of the map, facing east.
+//	@object <kind> <x> <y> [key=value...]: Object placed in the level with optional
+//	                                       properties. Values are URL query escaped.
+//	@trigger <event> <region> [once] <actions>: Actions fired by the player in the region,
+//	                                            see parseTrigger.
+//	@exit <region>: Exit of the level, ending it when entered.
+func parseLevel(mapData []byte) (*level, error) {
+	world, err := parseMap(mapData)
+	if err != nil {
+		return nil, err
+	}
+	lvl := &level{
+		world: world,
+		spawn: math2.Pt(float64(len(world[0])/2), float64(len(world))/2),
+	}
+	for _, d := range parseDirectives(mapData) {
+		if err := lvl.applyDirective(d); err != nil {
+			return nil, fmt.Errorf("line %d: %w", d[0].line, err)
+		}
+	}
+	return lvl, nil
+}
+
+// parseDirectives returns the directive lines of the map file.
+// The first token is the directive name, without the '@'.
+func parseDirectives(mapData []byte) [][]mapToken {
+	var out [][]mapToken
+	for i, line := range strings.Split(string(mapData), "\n") {
+		if line == "" || line[0] != '@' {
+			continue
+		}
+		var d []mapToken
+		for _, tok := range tokenizeMap([]byte(line[1:])) {
+			d = append(d, tok...)
+		}
+		if len(d) == 0 {
+			continue
+		}
+		for j := range d {
+			d[j].line, d[j].col = i+1, d[j].col+1
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// applyDirective sets the level metadata from the given directive.
+func (lvl *level) applyDirective(d []mapToken) error {
+	name, args := d[0].text, d[1:]
+	switch name {
+	case "spawn":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("spawn expects 2 or 3 arguments, got %d", len(args))
+		}
+		f, err := parseFloats(name, args)
+		if err != nil {
+			return err
+		}
+		lvl.spawn = math2.Pt(f[0], f[1])
+		if len(f) == 3 {
+			lvl.spawnDir = math2.NewDegAngle(f[2])
+		}
+	case "object":
+		if len(args) < 3 {
+			return fmt.Errorf("object expects at least 3 arguments, got %d", len(args))
+		}
+		f, err := parseFloats(name, args[1:3])
+		if err != nil {
+			return err
+		}
+		obj := levelObject{kind: args[0].text, pos: math2.Pt(f[0], f[1])}
+		for _, tok := range args[3:] {
+			k, v, ok := strings.Cut(tok.text, "=")
+			if !ok {
+				return fmt.Errorf("invalid object property %q, expected key=value", tok.text)
+			}
+			if v, err = url.QueryUnescape(v); err != nil {
+				return fmt.Errorf("invalid object property %q: %w", tok.text, err)
+			}
+			if obj.props == nil {
+				obj.props = map[string]string{}
+			}
+			obj.props[k] = v
+		}
+		lvl.objects = append(lvl.objects, obj)
+	case "trigger":
+		t, err := lvl.parseTrigger(args)
+		if err != nil {
+			return err
+		}
+		lvl.triggers = append(lvl.triggers, t)
+	case "exit":
+		t, err := lvl.parseExit(args)
+		if err != nil {
+			return err
+		}
+		lvl.triggers = append(lvl.triggers, t)
+	default:
+		return fmt.Errorf("unknown directive %q", name)
+	}
+	return nil
+}
+
+func parseFloats(directive string, args []mapToken) ([]float64, error) {
+	out := make([]float64, 0, len(args))
+	for _, tok := range args {
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s argument %q: %w", directive, tok.text, err)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// formatLevel encodes the level in the map file format.
+func formatLevel(lvl *level) []byte {
+	formatFloat := func(f float64) string {
+		// Round to avoid noise from the conversions.
+		return strconv.FormatFloat(math.Round(f*1e6)/1e6, 'f', -1, 64)
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "@spawn %s %s %s\n", formatFloat(lvl.spawn.X), formatFloat(lvl.spawn.Y), formatFloat(lvl.spawnDir.Degrees()))
+	for _, obj := range lvl.objects {
+		fmt.Fprintf(&buf, "@object %s %s %s", obj.kind, formatFloat(obj.pos.X), formatFloat(obj.pos.Y))
+		for _, k := range sortedKeys(obj.props) {
+			fmt.Fprintf(&buf, " %s=%s", k, url.QueryEscape(obj.props[k]))
+		}
+		buf.WriteByte('\n')
+	}
+	for _, t := range lvl.triggers {
+		directive := "trigger"
+		if t.exit {
+			directive = "exit"
+		}
+		fmt.Fprintf(&buf, "@%s %s\n", directive, formatTrigger(t))
+	}
+	for _, line := range lvl.world {
+		for x, p := range line {
+			if x > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(formatCell(p))
+		}
+		buf.WriteByte('\n')
+	}
+	return []byte(buf.String())
+}
+
+// copyWorld returns a copy of the world, so the game can change it without altering the level.
+func copyWorld(world [][]MapPoint) [][]MapPoint {
+	out := make([][]MapPoint, len(world))
+	for y, line := range world {
+		out[y] = append([]MapPoint(nil), line...)
+	}
+	return out
+}
+
+// sortedKeys returns the keys of the map, sorted.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// See-through wall types.
+//
+// 0 is an empty case, 1 to 0xf are opaque walls.
+// From 0x10, the walls are see-through: their texture has transparent pixels
+// and the rays go through them until they hit an opaque wall.
+// By default they block the player, or-ing the type with wallPassable
+// makes them walkable (i.e. 0x18 are bars the player can go through).
+const (
+	wallBars   = 0x10
+	wallFence  = 0x11
+	wallWindow = 0x12
+
+	wallPassable = 0x08
+)
+
 // MapPoint represents an individual point for the wireframe.
 // 3d vector with color.
 type MapPoint struct {
 	math2.Point
 	wallType int
+
+	// Custom floor/ceiling texture number + 1, 0 for the default one.
+	floor, ceiling int
+}
+
+// Default floor and ceiling textures.
+const (
+	defaultFloorTex   = 0
+	defaultCeilingTex = 4
+)
+
+func (p MapPoint) floorTexNum() int {
+	if p.floor == 0 {
+		return defaultFloorTex
+	}
+	return p.floor - 1
+}
+
+func (p MapPoint) ceilingTexNum() int {
+	if p.ceiling == 0 {
+		return defaultCeilingTex
+	}
+	return p.ceiling - 1
+}
+
+// seeThrough returns true if the point is a see-through wall.
+func (p MapPoint) seeThrough() bool {
+	return p.wallType >= wallBars
+}
+
+// solid returns true if the player can't walk through the point.
+func (p MapPoint) solid() bool {
+	if p.seeThrough() {
+		return p.wallType&wallPassable == 0
+	}
+	return p.wallType != 0
+}
+
+// maskedTexNum returns the index of the see-through wall texture.
+func (p MapPoint) maskedTexNum() int {
+	switch p.wallType &^ wallPassable {
+	case wallFence:
+		return 1
+	case wallWindow:
+		return 2
+	default:
+		return 0
+	}
 }
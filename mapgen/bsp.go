@@ -0,0 +1,77 @@
+package mapgen
+
+import (
+	"image"
+	"math/rand"
+)
+
+// Binary space partition settings.
+const (
+	bspMinLeaf = 6 // Minimum leaf size, including the walls around the room.
+	bspMinRoom = 3
+)
+
+// bsp splits the map recursively, places a room in each leaf
+// and connects the sibling rooms with corridors.
+func bsp(r *rand.Rand, grid [][]bool) {
+	for y := range grid {
+		for x := range grid[y] {
+			grid[y][x] = true
+		}
+	}
+	// Keep the borders out of the partition.
+	split(r, grid, image.Rect(1, 1, len(grid[0])-1, len(grid)-1))
+}
+
+// split partitions the area and returns a case inside the carved rooms.
+func split(r *rand.Rand, grid [][]bool, area image.Rectangle) image.Point {
+	w, h := area.Dx(), area.Dy()
+	canX, canY := w >= 2*bspMinLeaf, h >= 2*bspMinLeaf
+	if !canX && !canY {
+		return room(r, grid, area)
+	}
+
+	vertical := canX && (!canY || w > h || (w == h && r.Intn(2) == 0))
+	var a, b image.Rectangle
+	if vertical {
+		x := area.Min.X + bspMinLeaf + r.Intn(w-2*bspMinLeaf+1)
+		a, b = image.Rect(area.Min.X, area.Min.Y, x, area.Max.Y), image.Rect(x, area.Min.Y, area.Max.X, area.Max.Y)
+	} else {
+		y := area.Min.Y + bspMinLeaf + r.Intn(h-2*bspMinLeaf+1)
+		a, b = image.Rect(area.Min.X, area.Min.Y, area.Max.X, y), image.Rect(area.Min.X, y, area.Max.X, area.Max.Y)
+	}
+	pa, pb := split(r, grid, a), split(r, grid, b)
+	corridor(r, grid, pa, pb)
+	return pa
+}
+
+// room carves a random room in the leaf, keeping a wall on the far sides, and returns its center.
+func room(r *rand.Rand, grid [][]bool, leaf image.Rectangle) image.Point {
+	maxW, maxH := max(1, leaf.Dx()-1), max(1, leaf.Dy()-1)
+	w := min(maxW, bspMinRoom+r.Intn(max(1, maxW-bspMinRoom+1)))
+	h := min(maxH, bspMinRoom+r.Intn(max(1, maxH-bspMinRoom+1)))
+	x0 := leaf.Min.X + r.Intn(maxW-w+1)
+	y0 := leaf.Min.Y + r.Intn(maxH-h+1)
+	for y := y0; y < y0+h; y++ {
+		for x := x0; x < x0+w; x++ {
+			grid[y][x] = false
+		}
+	}
+	return image.Pt(x0+w/2, y0+h/2)
+}
+
+// corridor carves an L shaped corridor between the two cases.
+func corridor(r *rand.Rand, grid [][]bool, a, b image.Point) {
+	corner := image.Pt(b.X, a.Y)
+	if r.Intn(2) == 0 {
+		corner = image.Pt(a.X, b.Y)
+	}
+	for _, seg := range [][2]image.Point{{a, corner}, {corner, b}} {
+		from, to := seg[0], seg[1]
+		for x := min(from.X, to.X); x <= max(from.X, to.X); x++ {
+			for y := min(from.Y, to.Y); y <= max(from.Y, to.Y); y++ {
+				grid[y][x] = false
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package mapgen
+
+import "math/rand"
+
+// Cellular automata settings.
+const (
+	caveFill       = 45 // Initial percentage of walls.
+	caveIterations = 5
+)
+
+// cave generates caves with a cellular automata:
+// starting from noise, a case becomes a wall when most of its neighbors are walls.
+func cave(r *rand.Rand, grid [][]bool) {
+	height, width := len(grid), len(grid[0])
+	for y := range grid {
+		for x := range grid[y] {
+			grid[y][x] = x == 0 || y == 0 || x == width-1 || y == height-1 || r.Intn(100) < caveFill
+		}
+	}
+
+	next := make([][]bool, height)
+	for y := range next {
+		next[y] = make([]bool, width)
+	}
+	for i := 0; i < caveIterations; i++ {
+		for y := range grid {
+			for x := range grid[y] {
+				n := neighborWalls(grid, x, y)
+				next[y][x] = n >= 5 || (grid[y][x] && n >= 4)
+			}
+		}
+		for y := range grid {
+			copy(grid[y], next[y])
+		}
+	}
+}
+
+// neighborWalls counts the walls around the case, out of the map counting as walls.
+func neighborWalls(grid [][]bool, x, y int) int {
+	n := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			if yy, xx := y+dy, x+dx; yy < 0 || yy >= len(grid) || xx < 0 || xx >= len(grid[yy]) || grid[yy][xx] {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,146 @@
+// Package mapgen generates random levels from a seed.
+//
+// The same algorithm, size and seed always produce the same map.
+package mapgen
+
+import (
+	"fmt"
+	"image"
+	"math/rand"
+	"sort"
+)
+
+// MinSize is the minimum width/height of a generated map.
+const MinSize = 5
+
+// Map is a generated level.
+type Map struct {
+	Walls [][]int     // Wall type per case, 0 being empty.
+	Spawn image.Point // Empty case reachable from everywhere.
+}
+
+// generator fills the grid (true being a wall) using the given random source.
+type generator func(r *rand.Rand, grid [][]bool)
+
+//nolint:gochecknoglobals // Read-only registry.
+var generators = map[string]struct {
+	gen      generator
+	wallType int
+}{
+	"maze": {maze, 2},
+	"bsp":  {bsp, 1},
+	"cave": {cave, 5},
+}
+
+// Algorithms returns the supported algorithm names.
+func Algorithms() []string {
+	out := make([]string, 0, len(generators))
+	for name := range generators {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Generate creates a map of the given size with the given algorithm:
+//   - maze: recursive division maze,
+//   - bsp: rooms and corridors from a binary space partition,
+//   - cave: cellular automata caves.
+//
+// The borders are always closed and all the empty cases are connected.
+func Generate(algorithm string, width, height int, seed int64) (*Map, error) {
+	g, ok := generators[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm %q, expected one of %v", algorithm, Algorithms())
+	}
+	if width < MinSize || height < MinSize {
+		return nil, fmt.Errorf("map too small: %dx%d, minimum %dx%d", width, height, MinSize, MinSize)
+	}
+
+	r := rand.New(rand.NewSource(seed)) //nolint:gosec // Deterministic maps, not security related.
+	grid := make([][]bool, height)
+	for y := range grid {
+		grid[y] = make([]bool, width)
+	}
+	g.gen(r, grid)
+
+	// Close the borders.
+	for y := range grid {
+		grid[y][0], grid[y][width-1] = true, true
+	}
+	for x := 0; x < width; x++ {
+		grid[0][x], grid[height-1][x] = true, true
+	}
+
+	area := largestArea(grid)
+	if len(area) == 0 {
+		// Nothing left on tiny maps, make room for the player.
+		grid[height/2][width/2] = false
+		area = largestArea(grid)
+	}
+	m := &Map{
+		Walls: make([][]int, height),
+		Spawn: area[r.Intn(len(area))],
+	}
+	reachable := make(map[image.Point]bool, len(area))
+	for _, pt := range area {
+		reachable[pt] = true
+	}
+	for y := range grid {
+		m.Walls[y] = make([]int, width)
+		for x := range grid[y] {
+			// Fill the unreachable pockets.
+			if grid[y][x] || !reachable[image.Pt(x, y)] {
+				m.Walls[y][x] = g.wallType
+			}
+		}
+	}
+	return m, nil
+}
+
+// largestArea returns the cases of the largest connected empty area, in scan order.
+func largestArea(grid [][]bool) []image.Point {
+	var best []image.Point
+	seen := make([][]bool, len(grid))
+	for y := range grid {
+		seen[y] = make([]bool, len(grid[y]))
+	}
+	for y := range grid {
+		for x := range grid[y] {
+			if grid[y][x] || seen[y][x] {
+				continue
+			}
+			area := fill(grid, seen, image.Pt(x, y))
+			if len(area) > len(best) {
+				best = area
+			}
+		}
+	}
+	sort.Slice(best, func(i, j int) bool {
+		if best[i].Y != best[j].Y {
+			return best[i].Y < best[j].Y
+		}
+		return best[i].X < best[j].X
+	})
+	return best
+}
+
+// fill returns the empty cases connected to start, marking them as seen.
+func fill(grid, seen [][]bool, start image.Point) []image.Point {
+	seen[start.Y][start.X] = true
+	out := []image.Point{start}
+	for i := 0; i < len(out); i++ {
+		cur := out[i]
+		for _, next := range []image.Point{cur.Add(image.Pt(1, 0)), cur.Add(image.Pt(-1, 0)), cur.Add(image.Pt(0, 1)), cur.Add(image.Pt(0, -1))} {
+			if next.Y < 0 || next.Y >= len(grid) || next.X < 0 || next.X >= len(grid[next.Y]) {
+				continue
+			}
+			if grid[next.Y][next.X] || seen[next.Y][next.X] {
+				continue
+			}
+			seen[next.Y][next.X] = true
+			out = append(out, next)
+		}
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package mapgen_test
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"go.creack.net/wolf3d/mapgen"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	for _, algorithm := range mapgen.Algorithms() {
+		for _, size := range []image.Point{{mapgen.MinSize, mapgen.MinSize}, {6, 9}, {32, 32}, {64, 17}} {
+			for seed := int64(0); seed < 20; seed++ {
+				m, err := mapgen.Generate(algorithm, size.X, size.Y, seed)
+				if err != nil {
+					t.Fatalf("[%s %v %d] generate: %s", algorithm, size, seed, err)
+				}
+				checkMap(t, m, size)
+				if t.Failed() {
+					t.Fatalf("[%s %v %d] invalid map", algorithm, size, seed)
+				}
+			}
+		}
+	}
+}
+
+func checkMap(t *testing.T, m *mapgen.Map, size image.Point) {
+	t.Helper()
+
+	if len(m.Walls) != size.Y {
+		t.Fatalf("unexpected height: %d", len(m.Walls))
+	}
+	empty := 0
+	for y, row := range m.Walls {
+		if len(row) != size.X {
+			t.Fatalf("unexpected width on row %d: %d", y, len(row))
+		}
+		for x, wall := range row {
+			if (x == 0 || y == 0 || x == size.X-1 || y == size.Y-1) && wall == 0 {
+				t.Errorf("open border at %d/%d", x, y)
+			}
+			if wall == 0 {
+				empty++
+			}
+		}
+	}
+	if m.Walls[m.Spawn.Y][m.Spawn.X] != 0 {
+		t.Errorf("spawn %v in a wall", m.Spawn)
+	}
+
+	// All the empty cases are reachable from the spawn.
+	seen := map[image.Point]bool{m.Spawn: true}
+	queue := []image.Point{m.Spawn}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range []image.Point{cur.Add(image.Pt(1, 0)), cur.Add(image.Pt(-1, 0)), cur.Add(image.Pt(0, 1)), cur.Add(image.Pt(0, -1))} {
+			if !seen[next] && m.Walls[next.Y][next.X] == 0 {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	if len(seen) != empty {
+		t.Errorf("%d unreachable cases", empty-len(seen))
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	t.Parallel()
+
+	for _, algorithm := range mapgen.Algorithms() {
+		m1, err := mapgen.Generate(algorithm, 40, 30, 42)
+		if err != nil {
+			t.Fatalf("generate: %s", err)
+		}
+		m2, err := mapgen.Generate(algorithm, 40, 30, 42)
+		if err != nil {
+			t.Fatalf("generate: %s", err)
+		}
+		if !reflect.DeepEqual(m1, m2) {
+			t.Errorf("[%s] same seed, different maps", algorithm)
+		}
+		m3, err := mapgen.Generate(algorithm, 40, 30, 43)
+		if err != nil {
+			t.Fatalf("generate: %s", err)
+		}
+		if reflect.DeepEqual(m1, m3) {
+			t.Errorf("[%s] different seeds, same map", algorithm)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := mapgen.Generate("unknown", 10, 10, 0); err == nil {
+		t.Error("unknown algorithm should fail")
+	}
+	if _, err := mapgen.Generate("maze", mapgen.MinSize-1, 10, 0); err == nil {
+		t.Error("too small map should fail")
+	}
+}
@@ -0,0 +1,59 @@
+package mapgen
+
+import "math/rand"
+
+// maze generates a perfect maze by recursive division.
+//
+// Walls are on even coordinates, passages on odd ones.
+// With an even size, the extra last row/column stays solid.
+func maze(r *rand.Rand, grid [][]bool) {
+	height, width := len(grid), len(grid[0])
+	// Last odd index inside the borders.
+	maxX, maxY := (width-2)|1, (height-2)|1
+	if maxX >= width-1 {
+		maxX -= 2
+	}
+	if maxY >= height-1 {
+		maxY -= 2
+	}
+	for y := range grid {
+		for x := range grid[y] {
+			grid[y][x] = x > maxX || y > maxY
+		}
+	}
+	divide(r, grid, 1, 1, maxX, maxY)
+}
+
+// divide splits the chamber (inclusive odd bounds) with a wall with one passage, then recurses on both sides.
+func divide(r *rand.Rand, grid [][]bool, x0, y0, x1, y1 int) {
+	w, h := x1-x0, y1-y0
+	if w < 2 && h < 2 {
+		return
+	}
+	horizontal := h > w || (h == w && r.Intn(2) == 0)
+	if horizontal && h < 2 {
+		horizontal = false
+	}
+	if !horizontal && w < 2 {
+		horizontal = true
+	}
+
+	if horizontal {
+		// Even row between y0 and y1, odd passage column.
+		y := y0 + 1 + 2*r.Intn(h/2)
+		passage := x0 + 2*r.Intn(w/2+1)
+		for x := x0; x <= x1; x++ {
+			grid[y][x] = x != passage
+		}
+		divide(r, grid, x0, y0, x1, y-1)
+		divide(r, grid, x0, y+1, x1, y1)
+		return
+	}
+	x := x0 + 1 + 2*r.Intn(w/2)
+	passage := y0 + 2*r.Intn(h/2+1)
+	for y := y0; y <= y1; y++ {
+		grid[y][x] = y != passage
+	}
+	divide(r, grid, x0, y0, x-1, y1)
+	divide(r, grid, x+1, y0, x1, y1)
+}
@@ -4,6 +4,7 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"math"
 	"sort"
 
 	"github.com/hajimehoshi/ebiten/v2"
@@ -12,6 +13,39 @@ import (
 	"go.creack.net/wolf3d/math2"
 )
 
+// Zoom boundaries of the rotating minimap, in pixels per world case.
+const (
+	minimapMinZoom = 4
+	minimapMaxZoom = 64
+)
+
+// clampMinimapZoom returns the zoom level within the boundaries, keeping it positive for the divisions.
+func clampMinimapZoom(zoom int) int {
+	return min(minimapMaxZoom, max(minimapMinZoom, zoom))
+}
+
+// minimapBox returns the size of the minimap on the screen, small or full map depending on mapMod.
+func (g *Game) minimapBox(screenWidth, screenHeight int) (int, int) {
+	scale := 0.2
+	if g.mapMod == 1 {
+		scale = 1.0
+	}
+	return int(float64(screenWidth) * scale), int(float64(screenHeight) * scale)
+}
+
+// minimapView returns the world area of the minimap and the pixels per case to fit it in the given size.
+// Worlds too large for one pixel per case are clipped around the player.
+func (g *Game) minimapView(width, height int) (image.Rectangle, int) {
+	worldWidth, worldHeight := len(g.world[0]), len(g.world)
+	if scale := min(width/worldWidth, height/worldHeight); scale > 0 {
+		return image.Rect(0, 0, worldWidth, worldHeight), scale
+	}
+	w, h := max(1, min(width, worldWidth)), max(1, min(height, worldHeight))
+	x := min(max(0, int(g.pos.X)-w/2), worldWidth-w)
+	y := min(max(0, int(g.pos.Y)-h/2), worldHeight-h)
+	return image.Rect(x, y, x+w, y+h), 1
+}
+
 func rayVertices(x1, y1, x2, y2, x3, y3 float64) []ebiten.Vertex {
 	return []ebiten.Vertex{
 		{DstX: float32(x1), DstY: float32(y1), SrcX: 0, SrcY: 0, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
@@ -21,20 +55,54 @@ func rayVertices(x1, y1, x2, y2, x3, y3 float64) []ebiten.Vertex {
 }
 
 func (g *Game) minimap(width, height int) image.Image {
-	worldWidth, worldHeight := len(g.world[0]), len(g.world)
-	scale := min(width/worldWidth, height/worldHeight)
-	width, height = worldWidth*scale, worldHeight*scale
+	return g.renderMinimap(g.minimapView(width, height))
+}
 
-	var hits [100][100][2]*DDA
-	var hits2 [100][100][]*DDA
+// rotatingMinimap renders the area around the player, rotated so the player
+// always faces up and clipped to a circle of the given diameter.
+// The zoom level sets how many pixels are used for each world case.
+func (g *Game) rotatingMinimap(size int) image.Image {
+	view, geoM := g.rotatingMinimapView(size)
+	region := g.renderMinimap(view, clampMinimapZoom(g.minimapZoom))
 
-	shadowImage := ebiten.NewImage(width, height)
-	shadowImage.Fill(color.Black)
-	var img draw.Image = image.NewRGBA(image.Rect(0, 0, width, height))
-	img = ebiten.NewImageFromImage(img)
+	img := ebiten.NewImage(size, size)
+	center := float32(size) / 2
+	// Draw the circle first and only keep the part of the map within it.
+	vector.DrawFilledCircle(img, center, center, center, color.Black, true)
 
-	// Player position.
-	spos := g.pos.Scale(float64(scale))
+	op := &ebiten.DrawImageOptions{GeoM: geoM}
+	op.Blend = ebiten.BlendSourceAtop
+	img.DrawImage(region, op)
+
+	vector.StrokeCircle(img, center, center, center-1, 2, color.White, true)
+
+	return img
+}
+
+// rotatingMinimapView returns the world area covering the rotating minimap circle, regardless of the rotation,
+// and the transform of that area rendered at the zoom level to the minimap: the player in the center, facing up.
+func (g *Game) rotatingMinimapView(size int) (image.Rectangle, ebiten.GeoM) {
+	zoom := clampMinimapZoom(g.minimapZoom)
+	radius := float64(size) / 2 / float64(zoom)
+	view := image.Rect(
+		int(math.Floor(g.pos.X-radius)), int(math.Floor(g.pos.Y-radius)),
+		int(math.Ceil(g.pos.X+radius))+1, int(math.Ceil(g.pos.Y+radius))+1,
+	)
+
+	spos := g.pos.Sub(math2.Pt(view.Min.X, view.Min.Y)).Scale(float64(zoom))
+	var geoM ebiten.GeoM
+	geoM.Translate(-spos.X, -spos.Y)
+	// Rotate the player direction to point up (-pi/2).
+	geoM.Rotate(-math.Pi/2 - math.Atan2(g.dir.Y, g.dir.X))
+	geoM.Translate(float64(size)/2, float64(size)/2)
+	return view, geoM
+}
+
+// minimapRays casts a ray for each screen column and returns them
+// along with the set of walls they hit, keyed by world coordinates.
+func (g *Game) minimapRays() (rays []*DDA, visible map[image.Point]bool) {
+	rays = make([]*DDA, 0, g.width)
+	visible = map[image.Point]bool{}
 
 	// Go over each point along the X axis and cast a ray between the play and that point.
 	for x := 0; x < g.width; x++ {
@@ -45,37 +113,36 @@ func (g *Game) minimap(width, height int) image.Image {
 		dda := newDDA(cameraX, g.pos, g.dir, g.plane)
 		dda.run(g.world, g.pos)
 
-		hits2[dda.worldPt.X][dda.worldPt.Y] = append(hits2[dda.worldPt.X][dda.worldPt.Y], dda)
-
-		h := hits[dda.worldPt.X][dda.worldPt.Y]
-		if h[0] == nil {
-			h[0] = dda
-			h[1] = dda
-			hits[dda.worldPt.X][dda.worldPt.Y] = h
-		}
-		if dda.realWallDist < h[0].realWallDist {
-			h[0] = dda
-		}
-		if dda.realWallDist > h[1].realWallDist {
-			h[1] = dda
+		// See-through walls are visible as well.
+		for _, hit := range dda.seeThrough {
+			visible[hit.worldPt] = true
 		}
+		visible[dda.worldPt] = true
+		rays = append(rays, dda)
 	}
 
+	return rays, visible
+}
+
+// renderMinimap draws the given world area, in world cases, scaled by scale.
+// The area can go past the edges of the world.
+func (g *Game) renderMinimap(view image.Rectangle, scale int) *ebiten.Image {
+	width, height := view.Dx()*scale, view.Dy()*scale
+
+	rays, visible := g.minimapRays()
+
+	shadowImage := ebiten.NewImage(width, height)
+	shadowImage.Fill(color.Black)
+	var img draw.Image = image.NewRGBA(image.Rect(0, 0, width, height))
+	img = ebiten.NewImageFromImage(img)
+
+	// Player position, relative to the area.
+	spos := g.pos.Sub(math2.Pt(view.Min.X, view.Min.Y)).Scale(float64(scale))
+
 	opt := &ebiten.DrawTrianglesOptions{}
 	opt.Address = ebiten.AddressRepeat
 	opt.Blend = ebiten.BlendSourceOut
 
-	rays := make([]*DDA, 0, len(hits)*2)
-	for y := 0; y < worldHeight; y++ {
-		for x := 0; x < worldWidth; x++ {
-			elem := hits2[x][y]
-			if len(elem) == 0 {
-				continue
-			}
-			rays = append(rays, elem...)
-		}
-	}
-
 	getAngle := func(dda *DDA) math2.Angle {
 		return math2.GetAngle(spos, spos, dda.rayDir)
 	}
@@ -115,44 +182,59 @@ func (g *Game) minimap(width, height int) image.Image {
 		img = img1
 	}
 
-	g.drawMinimapWalls(img, scale, hits)
-	img = g.drawMinimapPlayer(img, scale)
+	g.drawMinimapWalls(img, view, scale, visible)
+	img = g.drawMinimapPlayer(img, view, scale)
 
-	return img
+	img1, _ := img.(*ebiten.Image)
+	return img1
 }
 
-func (g *Game) drawMinimapPlayer(i draw.Image, scale int) draw.Image {
+func (g *Game) drawMinimapPlayer(i draw.Image, view image.Rectangle, scale int) draw.Image {
 	img, _ := i.(*ebiten.Image)
 
-	spos := g.pos.Scale(float64(scale))
+	spos := g.pos.Sub(math2.Pt(view.Min.X, view.Min.Y)).Scale(float64(scale))
 	// Draw the player itself.
 	vector.DrawFilledCircle(img, float32(spos.X), float32(spos.Y), float32(min(1, scale)), color.RGBA{A: 255, R: 255}, true)
 	if g.showHighlight {
 		// Highlight the current world coordinate.
-		vector.StrokeRect(img, float32(int(g.pos.X)*scale), float32(int(g.pos.Y)*scale), float32(scale), float32(scale), 1, color.White, false)
+		x, y := int(g.pos.X)-view.Min.X, int(g.pos.Y)-view.Min.Y
+		vector.StrokeRect(img, float32(x*scale), float32(y*scale), float32(scale), float32(scale), 1, color.White, false)
 	}
 
 	return img
 }
 
-func (g *Game) drawMinimapWalls(i draw.Image, scale int, hits [100][100][2]*DDA) {
-	worldWidth, worldHeight := len(g.world[0]), len(g.world)
+func (g *Game) drawMinimapWalls(i draw.Image, view image.Rectangle, scale int, visible map[image.Point]bool) {
 	img, _ := i.(*ebiten.Image)
 
-	for y := 0; y < worldHeight; y++ {
-		for x := 0; x < worldWidth; x++ {
-			if g.showMinimapGrid {
-				vector.StrokeRect(img, float32(x*scale), float32(y*scale), float32(scale), float32(scale), 1, color.White, false)
-			}
-			c := g.getColor(x, y)
-			if c == color.Black {
-				continue
+	for y := max(0, view.Min.Y); y < min(len(g.world), view.Max.Y); y++ {
+		for x := max(0, view.Min.X); x < min(len(g.world[y]), view.Max.X); x++ {
+			// Position relative to the area.
+			sx, sy := float32((x-view.Min.X)*scale), float32((y-view.Min.Y)*scale)
+			if g.showMinimapGrid || g.editor.enabled {
+				vector.StrokeRect(img, sx, sy, float32(scale), float32(scale), 1, color.White, false)
 			}
-			if g.hideInvisibleWalls && hits[x][y][0] == nil {
+			c, ok := g.minimapCaseColor(x, y, visible)
+			if !ok {
 				continue
 			}
-
-			vector.DrawFilledRect(img, float32(x*scale), float32(y*scale), float32(scale), float32(scale), c, false)
+			vector.DrawFilledRect(img, sx, sy, float32(scale), float32(scale), c, false)
 		}
 	}
 }
+
+// minimapCaseColor returns the color of the case on the minimap, false if it is not drawn.
+func (g *Game) minimapCaseColor(x, y int, visible map[image.Point]bool) (color.Color, bool) {
+	c := g.getColor(x, y)
+	if c == color.Black {
+		return nil, false
+	}
+	// The editor shows the whole map.
+	if g.hideInvisibleWalls && !g.editor.enabled && !visible[image.Pt(x, y)] {
+		return nil, false
+	}
+	if g.fogOfWar && !g.editor.enabled && !g.explored.has(x, y) {
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// bigMap returns a closed map of the given size with a pillar every 8 cases.
+func bigMap(size int) []byte {
+	var buf strings.Builder
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			switch {
+			case x == 0 || y == 0 || x == size-1 || y == size-1:
+				buf.WriteString("1 ")
+			case x%8 == 0 && y%8 == 0:
+				buf.WriteString("2 ")
+			default:
+				buf.WriteString("0 ")
+			}
+		}
+		buf.WriteString("\n")
+	}
+	return []byte(buf.String())
+}
+
+func TestRotatingMinimapView(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name       string
+		pos, dir   math2.Point
+		zoom, size int
+		view       image.Rectangle
+	}{
+		{"east", math2.Pt(2.5, 3.5), math2.Pt(1, 0), 16, 64, image.Rect(0, 1, 6, 7)},
+		{"north", math2.Pt(10.25, 10.75), math2.Pt(0, -1), 8, 80, image.Rect(5, 5, 17, 17)},
+		{"south west", math2.Pt(1.5, 1.5), math2.Pt(-1, 1).Scale(1 / math.Sqrt2), 32, 128, image.Rect(-1, -1, 5, 5)},
+	} {
+		g := &Game{pos: tc.pos, dir: tc.dir, minimapZoom: tc.zoom}
+		view, geoM := g.rotatingMinimapView(tc.size)
+		if view != tc.view {
+			t.Errorf("[%s] unexpected view:\nexpect:\t%v\ngot:\t%v", tc.name, tc.view, view)
+		}
+
+		// World position to minimap pixel, through the rendered area.
+		toScreen := func(pt math2.Point) math2.Point {
+			spt := pt.Sub(math2.Pt(view.Min.X, view.Min.Y)).Scale(float64(tc.zoom))
+			return math2.Pt(geoM.Apply(spt.X, spt.Y))
+		}
+		center, zoom := float64(tc.size)/2, float64(tc.zoom)
+		right := math2.Pt(-tc.dir.Y, tc.dir.X)
+		for _, c := range []struct {
+			what          string
+			world, screen math2.Point
+		}{
+			{"player", tc.pos, math2.Pt(center, center)},
+			{"ahead", tc.pos.Add(tc.dir), math2.Pt(center, center-zoom)},
+			{"behind", tc.pos.Sub(tc.dir.Scale(2)), math2.Pt(center, center+2*zoom)},
+			{"right", tc.pos.Add(right), math2.Pt(center+zoom, center)},
+		} {
+			if got := toScreen(c.world); got.Magnitude(c.screen) > 1e-9 {
+				t.Errorf("[%s] unexpected %s position:\nexpect:\t%v\ngot:\t%v", tc.name, c.what, c.screen, got)
+			}
+		}
+	}
+}
+
+func TestRotatingMinimapZoom(t *testing.T) {
+	t.Parallel()
+
+	g := &Game{pos: math2.Pt(2.5, 3.5), dir: math2.Pt(1, 0), minimapZoom: minimapMinZoom}
+	expect, _ := g.rotatingMinimapView(64)
+	for _, zoom := range []int{0, -8, 1} {
+		g.minimapZoom = zoom
+		if view, _ := g.rotatingMinimapView(64); view != expect {
+			t.Errorf("[%d] unexpected view:\nexpect:\t%v\ngot:\t%v", zoom, expect, view)
+		}
+	}
+
+	// Zooming and loading clamp the zoom as well.
+	g.minimapZoom = 0
+	g.world = [][]MapPoint{{{}}}
+	if err := g.step(actZoomIn); err != nil {
+		t.Fatalf("step: %s", err)
+	}
+	if g.minimapZoom != minimapMinZoom {
+		t.Errorf("unexpected zoom after zooming in: %d", g.minimapZoom)
+	}
+	g.minimapZoom = 0
+	buf, err := g.marshalState()
+	if err != nil {
+		t.Fatalf("marshalState: %s", err)
+	}
+	if err := g.unmarshalState(buf); err != nil {
+		t.Fatalf("unmarshalState: %s", err)
+	}
+	if g.minimapZoom != minimapMinZoom {
+		t.Errorf("unexpected zoom after load: %d", g.minimapZoom)
+	}
+}
+
+func TestMinimapLargeWorld(t *testing.T) {
+	t.Parallel()
+
+	const size = 512
+
+	lvl, err := parseLevel(bigMap(size))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	if len(lvl.world) != size || len(lvl.world[0]) != size {
+		t.Fatalf("unexpected world size: %dx%d", len(lvl.world[0]), len(lvl.world))
+	}
+
+	g := &Game{width: 320, height: 200}
+	g.setLevel("big", lvl)
+
+	// Look at the bottom right corner, well past the 100x100 mark.
+	g.pos = math2.Pt(500.5, 500.5)
+	g.dir = math2.Pt(1, 1).Scale(1 / math2.Pt(1, 1).Norm())
+	g.plane = math2.Pt(-g.dir.Y, g.dir.X).Scale(0.66)
+	_ = g.frame()
+
+	rays, visible := g.minimapRays()
+	if expect, got := g.width, len(rays); expect != got {
+		t.Fatalf("unexpected ray count:\nexpect:\t%d\ngot:\t%d", expect, got)
+	}
+	for pt := range visible {
+		if pt.X < 500 || pt.Y < 500 {
+			t.Errorf("unexpected visible wall %v behind the player", pt)
+		}
+	}
+	// The pillar right in front of the player.
+	if !visible[image.Pt(504, 504)] || !g.explored.has(504, 504) {
+		t.Errorf("the pillar in front of the player should be visible and explored")
+	}
+	border := 0
+	for pt := range visible {
+		if pt.X == size-1 || pt.Y == size-1 {
+			border++
+		}
+	}
+	if border == 0 {
+		t.Errorf("the border walls should be visible")
+	}
+
+	// The minimap is clipped around the player to fit its box.
+	g.triangleImg = ebiten.NewImage(g.screenSize())
+	for _, mapMod := range []int{0, 1} {
+		g.mapMod = mapMod
+		width, height := g.minimapBox(g.screenSize())
+		view, scale := g.minimapView(width, height)
+		if scale != 1 || view.Dx() != width || view.Dy() != height || !image.Pt(500, 500).In(view) || !view.In(image.Rect(0, 0, size, size)) {
+			t.Errorf("[%d] unexpected view %v at scale %d for a %dx%d box", mapMod, view, scale, width, height)
+		}
+		img := g.minimap(width, height)
+		if b := img.Bounds(); b.Dx() > width || b.Dy() > height {
+			t.Errorf("[%d] minimap %v drawn outside of its %dx%d box", mapMod, b, width, height)
+		}
+	}
+	// The editor maps the screen to the clipped area.
+	view, _ := g.minimapView(g.screenSize())
+	if pt, ok := g.editorCase(160, 100); !ok || pt != view.Min.Add(image.Pt(160, 100)) {
+		t.Errorf("unexpected editor case in %v: %v %t", view, pt, ok)
+	}
+}
@@ -2,40 +2,39 @@ package main
 
 import "go.creack.net/wolf3d/math2"
 
-func (g *Game) moveForward(s float64) {
-	if newX := g.pos.X + g.dir.X*s; g.getTexNum(int(newX), int(g.pos.Y)) == 0 {
+// move moves the player by the given vector, sliding along the walls.
+func (g *Game) move(delta math2.Point) {
+	start := g.pos
+	if newX := g.pos.X + delta.X; !g.isSolid(int(newX), int(g.pos.Y)) {
 		g.pos.X = newX
 	}
-	if newY := g.pos.Y + g.dir.Y*s; g.getTexNum(int(g.pos.X), int(newY)) == 0 {
+	if newY := g.pos.Y + delta.Y; !g.isSolid(int(g.pos.X), int(newY)) {
 		g.pos.Y = newY
 	}
+	// Drives the head bob.
+	g.effects.walked += g.pos.Magnitude(start)
 }
 
+func (g *Game) moveForward(s float64) {
+	g.move(g.dir.Scale(s))
+}
+
+// right returns the unit vector pointing to the right of the view direction.
+func (g *Game) right() math2.Point {
+	return math2.Pt(-g.dir.Y, g.dir.X)
+}
+
+// moveLeft strafes at the speed of the original camera plane, whatever the field of view.
 func (g *Game) moveLeft(s float64) {
-	if newX := g.pos.X - g.plane.X*s; g.getTexNum(int(newX), int(g.pos.Y)) == 0 {
-		g.pos.X = newX
-	}
-	if newY := g.pos.Y - g.plane.Y*s; g.getTexNum(int(g.pos.X), int(newY)) == 0 {
-		g.pos.Y = newY
-	}
+	g.move(g.right().Scale(-defaultPlane * s))
 }
 
 func (g *Game) moveBackwards(s float64) {
-	if newX := g.pos.X - g.dir.X*s; g.getTexNum(int(newX), int(g.pos.Y)) == 0 {
-		g.pos.X = newX
-	}
-	if newY := g.pos.Y - g.dir.Y*s; g.getTexNum(int(g.pos.X), int(newY)) == 0 {
-		g.pos.Y = newY
-	}
+	g.move(g.dir.Scale(-s))
 }
 
 func (g *Game) moveRight(s float64) {
-	if newX := g.pos.X + g.plane.X*s; g.getTexNum(int(newX), int(g.pos.Y)) == 0 {
-		g.pos.X = newX
-	}
-	if newY := g.pos.Y + g.plane.Y*s; g.getTexNum(int(g.pos.X), int(newY)) == 0 {
-		g.pos.Y = newY
-	}
+	g.move(g.right().Scale(defaultPlane * s))
 }
 
 func (g *Game) turnRight(s float64) {
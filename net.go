@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Network protocol.
+//
+// The client sends a join message, the server answers with a welcome message holding the player id and the level,
+// then the client sends its input actions when they change and the server broadcasts the players states on each tick.
+const (
+	netMsgJoin    = "join"
+	netMsgWelcome = "welcome"
+	netMsgInput   = "input"
+	netMsgState   = "state"
+
+	netMaxMessage = 1 << 20 // Maximum message size, the welcome message holding the level being the biggest.
+)
+
+// netMessage is a message between a client and the server.
+type netMessage struct {
+	Type string `json:"type"`
+
+	// Join.
+	Name string `json:"name,omitempty"`
+
+	// Welcome.
+	ID    int    `json:"id,omitempty"`
+	Map   string `json:"map,omitempty"`
+	Level string `json:"level,omitempty"` // In the map format.
+
+	// Input.
+	Actions actions `json:"actions,omitempty"`
+
+	// State.
+	Tick    uint64      `json:"tick,omitempty"`
+	Players []netPlayer `json:"players,omitempty"`
+}
+
+// netPlayer is the state of a player, as broadcasted by the server.
+type netPlayer struct {
+	ID    int         `json:"id"`
+	Name  string      `json:"name"`
+	Pos   math2.Point `json:"pos"`
+	Dir   math2.Point `json:"dir"`
+	Plane math2.Point `json:"plane"`
+}
+
+// netConn is a message based connection between a client and the server.
+type netConn interface {
+	send(msg *netMessage) error // Safe for concurrent use.
+	recv() (*netMessage, error)
+	Close() error
+}
+
+// streamConn sends the messages over a stream (i.e. TCP) as JSON prefixed by its big endian uint32 length.
+type streamConn struct {
+	rwc io.ReadWriteCloser
+	r   *bufio.Reader
+
+	mu sync.Mutex // Serializes the writes.
+}
+
+func newStreamConn(rwc io.ReadWriteCloser) *streamConn {
+	return &streamConn{rwc: rwc, r: bufio.NewReader(rwc)}
+}
+
+func (c *streamConn) send(msg *netMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), uint32(len(data)))
+	buf = append(buf, data...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.rwc.Write(buf); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (c *streamConn) recv() (*netMessage, error) {
+	var size uint32
+	if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("read size: %w", err)
+	}
+	if size > netMaxMessage {
+		return nil, fmt.Errorf("message too big: %d", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	msg := &netMessage{}
+	if err := json.Unmarshal(buf, msg); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return msg, nil
+}
+
+func (c *streamConn) Close() error { return c.rwc.Close() }
+
+// expectMessage receives the next message, failing if not of the given type.
+func expectMessage(c netConn, typ string) (*netMessage, error) {
+	msg, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != typ {
+		return nil, fmt.Errorf("unexpected %q message, expected %q", msg.Type, typ)
+	}
+	return msg, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"net"
+	"testing"
+	"time"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// startTestServer runs a server on a loopback port.
+func startTestServer(t *testing.T) (*server, string) {
+	t.Helper()
+
+	lvl, err := parseLevel(bigMap(8))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	lvl.spawn = math2.Pt(2.5, 2.5)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	s := newServer("test", lvl)
+	go func() { _ = s.serve(l) }() // Stopped by Close.
+	go func() { _ = s.run() }()    // Stopped by Close.
+	t.Cleanup(func() { _ = s.Close() })
+	return s, l.Addr().String()
+}
+
+func dialTestClient(t *testing.T, addr, name string) *netClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	c, err := dialClient(newStreamConn(conn), name)
+	if err != nil {
+		t.Fatalf("dialClient: %s", err)
+	}
+	t.Cleanup(func() { _ = c.conn.Close() })
+	return c
+}
+
+// waitFor polls the condition until true or timeout.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timeout waiting for %s", what)
+}
+
+func TestMultiplayer(t *testing.T) {
+	t.Parallel()
+
+	_, addr := startTestServer(t)
+	c1 := dialTestClient(t, addr, "alice")
+	c2 := dialTestClient(t, addr, "")
+	if c1.id == c2.id || c1.mapName != "test" || len(c1.lvl.world) != 8 {
+		t.Fatalf("unexpected welcome: %d %d %q", c1.id, c2.id, c1.mapName)
+	}
+
+	g1, g2 := &Game{width: 64, height: 48}, &Game{width: 64, height: 48}
+	g1.joinServer(c1)
+	g2.joinServer(c2)
+
+	// Both players are known by both clients.
+	waitFor(t, "players", func() bool {
+		_, players, _ := c2.state()
+		return len(players) == 2 && players[0].Name == "alice" && players[1].Name == "player2"
+	})
+
+	// Alice moves forward: the server moves her and the other client sees it.
+	if err := g1.updateNet(actForward); err != nil {
+		t.Fatalf("updateNet: %s", err)
+	}
+	waitFor(t, "alice to move", func() bool {
+		if err := g2.updateNet(0); err != nil {
+			t.Fatalf("updateNet: %s", err)
+		}
+		return len(g2.sprites) == 1 && g2.sprites[0].pos.X > 4
+	})
+	// The states reach each client on its own, alice may not have the last one yet.
+	waitFor(t, "alice to see her move", func() bool {
+		if err := g1.updateNet(0); err != nil {
+			t.Fatalf("updateNet: %s", err)
+		}
+		return g1.pos.X > 4
+	})
+	if g1.pos.Y != 2.5 {
+		t.Errorf("unexpected position: %v", g1.pos)
+	}
+	if g2.pos != math2.Pt(2.5, 2.5) {
+		t.Errorf("other player should not move: %v", g2.pos)
+	}
+	// Walls stop the players on the server as well.
+	if g1.pos.X >= 7 {
+		t.Errorf("player went through the wall: %v", g1.pos)
+	}
+
+	// Disconnected players are removed.
+	_ = c1.conn.Close()
+	waitFor(t, "alice to leave", func() bool {
+		_, players, _ := c2.state()
+		return len(players) == 1
+	})
+}
+
+func TestSpritesFrame(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap(bigMap(8))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	g := &Game{width: 64, height: 48, world: world, explored: newExploredSet(world), pos: math2.Pt(1.5, 1.5), dir: math2.Pt(1, 0), plane: math2.Pt(0, 0.66)}
+	// Only the sprite texture is colored.
+	for y := range g.texturesCache {
+		for x := playerTexNum * texSize; x < (playerTexNum+1)*texSize; x++ {
+			g.texturesCache[y][x] = [3]byte{1, 2, 3}
+		}
+	}
+	center := (g.height/2*g.width + g.width/2) * 4
+
+	g.sprites = []sprite{{pos: math2.Pt(3.5, 1.5), texNum: playerTexNum}}
+	img, _ := g.frame().(*image.RGBA) // Always RGBA.
+	if got := img.Pix[center : center+3]; got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("sprite not drawn in front of the player: %v", got)
+	}
+
+	// Hidden by a wall.
+	g.world[1][2].wallType = 1
+	img, _ = g.frame().(*image.RGBA) // Always RGBA.
+	if got := img.Pix[center : center+3]; got[0] == 1 && got[1] == 2 && got[2] == 3 {
+		t.Error("sprite behind a wall should not be drawn")
+	}
+	g.world[1][2].wallType = 0
+
+	// Behind the player.
+	g.sprites = []sprite{{pos: math2.Pt(1, 1.5), texNum: playerTexNum}}
+	before, _ := g.frame().(*image.RGBA) // Always RGBA.
+	g.sprites = nil
+	after, _ := g.frame().(*image.RGBA) // Always RGBA.
+	if !bytes.Equal(before.Pix, after.Pix) {
+		t.Error("sprite behind the player should not be drawn")
+	}
+}
+
+func TestSpritesSeeThrough(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap(bigMap(8))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	g := &Game{width: 64, height: 48, world: world, explored: newExploredSet(world), pos: math2.Pt(1.5, 1.5), dir: math2.Pt(1, 0), plane: math2.Pt(0, 0.66)}
+	// Sprite and opaque see-through textures, each its own color.
+	for y := range g.texturesCache {
+		for x := playerTexNum * texSize; x < (playerTexNum+1)*texSize; x++ {
+			g.texturesCache[y][x] = [3]byte{1, 2, 3}
+		}
+		for x := range g.maskedTexturesCache[y] {
+			g.maskedTexturesCache[y][x] = [4]byte{4, 5, 6, 255}
+		}
+	}
+	center := (g.height/2*g.width + g.width/2) * 4
+	g.sprites = []sprite{{pos: math2.Pt(3.5, 1.5), texNum: playerTexNum}}
+
+	// Behind the bars.
+	g.world[1][2].wallType = wallBars
+	img, _ := g.frame().(*image.RGBA) // Always RGBA.
+	if got := img.Pix[center : center+3]; got[0] != 4 || got[1] != 5 || got[2] != 6 {
+		t.Errorf("sprite drawn over the bars in front of it: %v", got)
+	}
+	g.world[1][2].wallType = 0
+
+	// In front of the bars.
+	g.world[1][4].wallType = wallBars
+	img, _ = g.frame().(*image.RGBA) // Always RGBA.
+	if got := img.Pix[center : center+3]; got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("bars behind the sprite drawn over it: %v", got)
+	}
+}
+
+func TestServerLevelEvents(t *testing.T) {
+	t.Parallel()
+
+	lvl, err := parseLevel([]byte("@spawn 1.5 1.5\n@exit 3,1\n@object treasure 2.5 1.5\n" + triggerCorridor))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	s := newServer("test", lvl)
+	p, err := s.addPlayer("alice", nil)
+	if err != nil {
+		t.Fatalf("addPlayer: %s", err)
+	}
+	if p.game.lvl == s.lvl {
+		t.Fatal("level shared between the server and the player")
+	}
+
+	// Walk over the treasure onto the exit.
+	p.input = actForward
+	for i := 0; i < tickRate; i++ {
+		if err := s.update(); err != nil {
+			t.Fatalf("update: %s", err)
+		}
+	}
+	if p.game.pos.X < 3 {
+		t.Fatalf("player didn't reach the exit: %v", p.game.pos)
+	}
+	if expect, got := "test", p.game.mapName; expect != got {
+		t.Errorf("player left the server map, expect %q, got %q", expect, got)
+	}
+	if len(p.game.objects) != 1 || len(s.lvl.objects) != 1 {
+		t.Errorf("treasure picked up: %v %v", p.game.objects, s.lvl.objects)
+	}
+}
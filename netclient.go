@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// netClient is the connection of the game to a multiplayer server.
+type netClient struct {
+	conn    netConn
+	id      int
+	mapName string
+	lvl     *level
+
+	lastInput actions
+
+	mu      sync.Mutex
+	tick    uint64
+	players []netPlayer // Latest state.
+	err     error       // Connection error, set once disconnected.
+}
+
+// dialClient joins the server on the given connection.
+func dialClient(conn netConn, name string) (*netClient, error) {
+	if err := conn.send(&netMessage{Type: netMsgJoin, Name: name}); err != nil {
+		return nil, fmt.Errorf("send join: %w", err)
+	}
+	welcome, err := expectMessage(conn, netMsgWelcome)
+	if err != nil {
+		return nil, fmt.Errorf("welcome: %w", err)
+	}
+	lvl, err := parseLevel([]byte(welcome.Level))
+	if err != nil {
+		return nil, fmt.Errorf("parseLevel: %w", err)
+	}
+	c := &netClient{conn: conn, id: welcome.ID, mapName: welcome.Map, lvl: lvl}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *netClient) readLoop() {
+	for {
+		msg, err := c.conn.recv()
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		if msg.Type != netMsgState {
+			continue
+		}
+		c.mu.Lock()
+		c.tick, c.players = msg.Tick, msg.Players
+		c.mu.Unlock()
+	}
+}
+
+// sendInput sends the movement actions to the server when they change.
+func (c *netClient) sendInput(a actions) error {
+	a &= movementActions
+	if a == c.lastInput {
+		return nil
+	}
+	c.lastInput = a
+	return c.conn.send(&netMessage{Type: netMsgInput, Actions: a})
+}
+
+// state returns the latest players state.
+func (c *netClient) state() (tick uint64, players []netPlayer, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tick, c.players, c.err
+}
+
+// joinServer switches the game to multiplayer on the server level.
+func (g *Game) joinServer(c *netClient) {
+	g.setLevel(c.mapName, c.lvl)
+	g.net, g.networked, g.campaign = c, true, nil
+}
+
+// updateNet sends the inputs to the server and applies the latest state:
+// the server moves the player, the other players become sprites.
+func (g *Game) updateNet(input actions) error {
+	if err := g.net.sendInput(input); err != nil {
+		return fmt.Errorf("sendInput: %w", err)
+	}
+	// Local toggles only, the map is set by the server.
+	if _, err := g.advance(input &^ movementActions &^ actNextMap); err != nil {
+		return err
+	}
+
+	_, players, err := g.net.state()
+	if err != nil {
+		return fmt.Errorf("disconnected: %w", err)
+	}
+	g.sprites = g.sprites[:0]
+	for _, p := range players {
+		if p.ID == g.net.id {
+			// Keep the local field of view.
+			g.pos, g.dir = p.Pos, p.Dir
+			g.updatePlane()
+			continue
+		}
+		g.sprites = append(g.sprites, sprite{pos: p.Pos, texNum: playerTexNum})
+	}
+	return nil
+}
+
+// cmdJoin plays on a multiplayer server.
+func cmdJoin(args []string) error {
+	fs := flag.NewFlagSet("join", flag.ContinueOnError)
+	name := fs.String("name", os.Getenv("USER"), "Player name.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: join [-name name] <host:port|ws://host:port/ws>")
+	}
+
+	var conn netConn
+	if addr := fs.Arg(0); isWebSocketURL(addr) {
+		wc, err := dialWebSocket(addr)
+		if err != nil {
+			return err
+		}
+		conn = wc
+	} else {
+		tc, err := net.Dial("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("dial: %w", err)
+		}
+		conn = newStreamConn(tc)
+	}
+	c, err := dialClient(conn, *name)
+	if err != nil {
+		_ = conn.Close() // Best effort.
+		return err
+	}
+	defer func() { _ = c.conn.Close() }() // Best effort.
+
+	g, err := newGame()
+	if err != nil {
+		return err
+	}
+	g.joinServer(c)
+	return runGame(g)
+}
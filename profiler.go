@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Profiler settings.
+const (
+	profilerFrames = 240                // Number of frames in the graph.
+	profilerScale  = 4                  // Graph pixels per millisecond.
+	profilerBudget = time.Second / 60   // Frame time target, drawn as a line.
+	profilerHeight = 40 * profilerScale // Graph height, 40ms.
+	profilerWidth  = profilerFrames * 1 // Graph width, 1 pixel per frame.
+	profilerMargin = 8                  // Distance to the bottom left corner.
+	profilerLegend = 5 * 16             // Height of the legend text.
+	profilerSample = 16                 // Floor/ceiling timed every profilerSample columns, scaled up.
+	profilerTop    = profilerHeight + profilerLegend + profilerMargin
+)
+
+// frameStats is the time spent in each phase of a frame.
+type frameStats struct {
+	raycast    time.Duration // Walls, including the see-through ones.
+	background time.Duration // Floor and ceiling.
+	minimap    time.Duration
+	upload     time.Duration // Image conversions and copies to the GPU. Only the CPU side as the GPU runs asynchronously.
+}
+
+func (s frameStats) phases() [4]time.Duration {
+	return [4]time.Duration{s.raycast, s.background, s.minimap, s.upload}
+}
+
+//nolint:gochecknoglobals // Read-only phases display settings.
+var profilerPhases = [4]struct {
+	name  string
+	color color.RGBA
+}{
+	{"raycast", color.RGBA{R: 255, G: 80, B: 80, A: 255}},
+	{"floor/ceiling", color.RGBA{R: 80, G: 200, B: 80, A: 255}},
+	{"minimap", color.RGBA{R: 80, G: 120, B: 255, A: 255}},
+	{"upload", color.RGBA{R: 255, G: 200, B: 0, A: 255}},
+}
+
+// profiler keeps the stats of the last frames. A nil profiler is disabled and doesn't measure anything.
+type profiler struct {
+	frames  [profilerFrames]frameStats
+	next    int // Index of the next frame in the ring buffer.
+	count   int
+	current frameStats // Frame being measured.
+}
+
+// now returns the current time, or the zero time when disabled to avoid the overhead.
+func (p *profiler) now() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// since returns the time elapsed since t, 0 when disabled.
+func (p *profiler) since(t time.Time) time.Duration {
+	if p == nil {
+		return 0
+	}
+	return time.Since(t)
+}
+
+// addBackground accumulates the floor/ceiling time of the current frame.
+func (p *profiler) addBackground(d time.Duration) {
+	if p != nil {
+		p.current.background += d
+	}
+}
+
+// record stores the current frame stats and starts a new frame.
+func (p *profiler) record() {
+	if p == nil {
+		return
+	}
+	p.frames[p.next] = p.current
+	p.next = (p.next + 1) % profilerFrames
+	p.count = min(profilerFrames, p.count+1)
+	p.current = frameStats{}
+}
+
+// average returns the mean time of each phase.
+func (p *profiler) average() frameStats {
+	var sum [4]time.Duration
+	for i := 0; i < p.count; i++ {
+		for j, d := range p.frames[i].phases() {
+			sum[j] += d
+		}
+	}
+	n := time.Duration(max(1, p.count))
+	return frameStats{raycast: sum[0] / n, background: sum[1] / n, minimap: sum[2] / n, upload: sum[3] / n}
+}
+
+// draw graphs the frames in the bottom left corner, stacking the phases, oldest on the left.
+func (p *profiler) draw(img *ebiten.Image) {
+	x0 := float32(profilerMargin)
+	y0 := float32(img.Bounds().Dy() - profilerMargin)
+	vector.DrawFilledRect(img, x0, y0-profilerTop+profilerMargin, profilerWidth, profilerTop-profilerMargin, color.RGBA{A: 160}, false)
+
+	for i := 0; i < p.count; i++ {
+		stats := p.frames[(p.next-p.count+i+profilerFrames)%profilerFrames]
+		y := y0
+		for j, d := range stats.phases() {
+			h := float32(d.Seconds() * 1000 * profilerScale)
+			h = min(h, y-(y0-profilerHeight))
+			vector.DrawFilledRect(img, x0+float32(i), y-h, 1, h, profilerPhases[j].color, false)
+			y -= h
+		}
+	}
+	budget := y0 - float32(profilerBudget.Seconds()*1000*profilerScale)
+	vector.StrokeLine(img, x0, budget, x0+profilerWidth, budget, 1, color.White, false)
+
+	avg := p.average()
+	legend := ""
+	var total time.Duration
+	for j, d := range avg.phases() {
+		legend += fmt.Sprintf("%s: %.2fms\n", profilerPhases[j].name, d.Seconds()*1000)
+		vector.DrawFilledRect(img, x0+2, y0-profilerTop+profilerMargin+float32(j*16)+6, 6, 6, profilerPhases[j].color, false)
+		total += d
+	}
+	legend += fmt.Sprintf("total: %.2fms (line: %.1fms)", total.Seconds()*1000, profilerBudget.Seconds()*1000)
+	ebitenutil.DebugPrintAt(img, legend, int(x0)+10, int(y0)-profilerTop+profilerMargin)
+}
@@ -13,33 +13,89 @@ import (
 	"go.creack.net/wolf3d/math2"
 )
 
-const texSize = 64
+const (
+	texSize     = 64
+	numTextures = 8
+)
 
 // Game holds the state.
 type Game struct {
 	mapName string
-	world   [][]MapPoint
+	world   [][]MapPoint  // Current world, changed by the triggers while playing.
+	objects []levelObject // Objects left in the current level.
+	lvl     *level        // Current level as loaded, kept to save the edited world with its directives.
+
+	width, height int // Render resolution, the screen size scaled by renderScale.
 
-	width, height int
+	screenWidth, screenHeight int               // Logical screen size, where the HUD is drawn. Defaults to the render resolution.
+	renderScale               float64           // Render resolution scale, 1 when 0.
+	renderFilter              ebiten.Filter     // Filter used to upscale the frame to the screen.
+	dynamicRes                dynamicResolution // Adjusts the render scale to the frame time.
 
 	// NOTE: FOV is the ration of dir/plane vectors.
 	dir   math2.Point // Direction vector.
 	plane math2.Point // Camera plane vector.
+	fov   float64     // Horizontal field of view in degrees, defaultFOV when 0.
+
+	// Vertical look and camera height.
+	pitch     float64 // Horizon offset in screen heights, positive looking up.
+	jumpZ     float64 // Height of the feet above the floor.
+	jumpVel   float64 // Vertical speed while jumping.
+	crouchZ   float64 // Eye height lost while crouching.
+	mouseLook bool    // Look up/down with the mouse.
+	cursorY   *int    // Last cursor position for the mouse look, nil when not started.
+
+	effects effects // Head bob, shake, flashes and fades.
+	capture capture // Screenshot and frame capture.
 
 	pos math2.Point // Current player position.
 
-	last time.Time // Time when last frame was rendered. Used to scale movements.
+	// Fixed timestep simulation.
+	clock   func() time.Time // Injectable clock, defaults to time.Now.
+	last    time.Time        // Simulation time, advanced by tickDuration on each tick.
+	tick    uint64           // Number of ticks run.
+	pending actions          // One-shot actions waiting for the next tick.
+
+	recording *demo       // Demo being recorded, if any.
+	playback  *demoPlayer // Demo being played, replacing the player inputs, if any.
 
-	mapMod             int // -1: hidden, 0: minimap, 1: fullmap.
+	explored exploredSet    // Cases seen by the player since the map was loaded.
+	triggers []triggerState // State of the level triggers.
+	stats    levelStats     // Player stats on the level.
+
+	campaign    *campaignProgress // Campaign progress, nil when playing a single map.
+	campaignDef *campaign         // Loaded campaign, nil until started.
+
+	mapMod             int // -1: hidden, 0: minimap, 1: fullmap, 2: rotating minimap.
+	minimapZoom        int // Pixels per world case in the rotating minimap.
 	showRays           bool
 	showHighlight      bool // Highlight the player's square.
 	showMinimapGrid    bool
 	hideInvisibleWalls bool
+	fogOfWar           bool // Only show the explored walls on the minimap.
+
+	editor  editor
+	console console
+	noclip  bool // Walk through the walls.
+
+	profiler *profiler // Frame time overlay, nil when hidden.
+
+	net       *netClient // Multiplayer connection, nil when playing alone.
+	networked bool       // Multiplayer game, client or server side. The level events are not synced yet, so they are disabled.
+	sprites   []sprite   // Objects drawn in the world, i.e. the other players.
+	zBuffer   []float64  // Wall distance of each column of the last frame, hiding the sprites.
+	// See-through walls of each column left to draw, interleaved with the sprites by distance.
+	seeThrough []seeThroughColumn
+
+	saveSlot int    // Current quick-save slot, 1 to saveMaxSlots.
+	message  string // Last action result, displayed in the HUD.
 
 	// Preloaded/cache data.
 	textures, sideTextures           *image.RGBA
-	texturesCache, sideTexturesCache [texSize][texSize * 8][3]byte
-	triangleImg                      *ebiten.Image
+	texturesCache, sideTexturesCache [texSize][texSize * numTextures][3]byte
+	// See-through walls textures, with alpha.
+	maskedTexturesCache, maskedSideTexturesCache [texSize][texSize * 3][4]byte
+	triangleImg                                  *ebiten.Image
 }
 
 func (g *Game) loadMap(name string) error {
@@ -48,24 +104,44 @@ func (g *Game) loadMap(name string) error {
 		return fmt.Errorf("readFile %q: %w", name, err)
 	}
 
-	world, err := parseMap(buf)
+	lvl, err := parseLevelFile(name, buf)
 	if err != nil {
-		return fmt.Errorf("parseMap: %w", err)
+		return fmt.Errorf("parseLevelFile: %w", err)
 	}
-	g.mapName = strings.TrimPrefix(name, "maps/")
-	g.pos = math2.Pt(float64(len(world[0])/2), float64(len(world))/2)
-	g.dir = math2.Pt(1, 0)
-	g.plane = math2.Pt(0, 0.66)
-	g.world = world
+	g.setLevel(strings.TrimPrefix(name, "maps/"), lvl)
+	g.startFade(g.effects.last)
 
 	return nil
 }
 
+// setLevel replaces the current world and resets the player at the spawn point.
+func (g *Game) setLevel(name string, lvl *level) {
+	g.mapName = name
+	g.lvl = lvl
+	g.pos = lvl.spawn
+	g.dir = math2.Pt(1, 0).Rotate(lvl.spawnDir)
+	g.updatePlane()
+	g.world = copyWorld(lvl.world)
+	g.objects = append([]levelObject(nil), lvl.objects...)
+	g.explored = newExploredSet(lvl.world)
+	g.resetTriggers()
+	g.resetStats()
+	g.editor.stroke, g.editor.undo, g.editor.redo = nil, nil, nil
+}
+
 // Implements the DDA algoright (Digital Differential Analysis).
 func (g *Game) frame() image.Image {
 	img := image.NewRGBA(image.Rect(0, 0, g.width, g.height))
 	// NOTE: Perf gain by using a buffer variable vs using img.Pix directly.
 	buffer := img.Pix
+	if len(g.zBuffer) != g.width {
+		g.zBuffer = make([]float64, g.width)
+	}
+	if len(g.seeThrough) != g.width {
+		g.seeThrough = make([]seeThroughColumn, g.width)
+	}
+	focal := g.focalLength()
+	horizon, eye := g.horizon(), g.eyeZ()
 
 	// img := image.NewRGBA(image.Rect(0, 0, g.width, g.height))
 	// Go over each point along the X axis and cast a ray between the play and that point.
@@ -82,50 +158,25 @@ func (g *Game) frame() image.Image {
 		// to the nearest wall as well as if we touch it from the X or Y side.
 		dda := newDDA(cameraX, g.pos, g.dir, g.plane)
 		dda.run(g.world, g.pos)
+		g.explored.markRay(dda)
+		g.zBuffer[x] = dda.perpWallDist
 
 		// Calculate height of line to draw on screen.
-		lineHeight := max(1, int(float64(g.height)/dda.perpWallDist))
+		lineHeight := max(1, int(focal/dda.perpWallDist))
 
 		// Calculate lowest and highest pixel to fill in current stripe.
 		//
-		// The center of the wall should be at the center of the screen,
-		// and if these points lie outside the screen, they're capped to 0 or g.height-1.
+		// The eye level of the wall is on the horizon, the center of the screen when looking straight,
+		// and if these points lie outside the screen, they're capped to 0 or g.height.
 		//
-		// The y center of the screen is g.height/2. Start from there -1/2 length to there +1/2 length.
-		drawStart, drawEnd := max(0, g.height/2-lineHeight/2), min(g.height-1, g.height/2+lineHeight/2)
+		// Standing, the eye is at half the wall height: start from the horizon -1/2 length to there +1/2 length.
+		top, drawStart, drawEnd := wallSpan(lineHeight, horizon, g.height, eye)
 
-		// The value wallX represents the exact value where the
-		// wall was hit, not just the integer coordinates of the wall.
-		// This is required to know which x-coordinate of the texture
-		// we have to use.
-		//
-		// This is calculated by first calculating the exact
-		// x or y coordinate in the world, and then subtracting
-		// the integer value of the wall off it.
-		//
-		// Note that even if it's called wallX, it's actually an
-		// y-coordinate of the wall if side==1, but it's always
-		// the x-coordinate of the texture.
-		var wallX float64 // Where exactly the wall was hit.
-		if !dda.side {
-			wallX = g.pos.Y + dda.perpWallDist*dda.rayDir.Y
-		} else {
-			wallX = g.pos.X + dda.perpWallDist*dda.rayDir.X
-		}
-		wallX -= math.Floor(wallX)
-
-		// x coordinate on the texture.
-		texX := int(wallX * texSize)
-		if !dda.side && dda.rayDir.X > 0 {
-			texX = texSize - texX - 1
-		}
-		if dda.side && dda.rayDir.Y < 0 {
-			texX = texSize - texX - 1
-		}
+		wallX, texX := getTexX(g.pos, dda.rayDir, dda.side, dda.perpWallDist)
 
 		texNum := g.getTexNum(dda.worldPt.X, dda.worldPt.Y)
 		for y := drawStart; y < drawEnd; y++ {
-			d := y - (g.height/2 - lineHeight/2)
+			d := y - top
 			texY := (d * texSize) / lineHeight
 
 			texs := &g.texturesCache
@@ -139,13 +190,102 @@ func (g *Game) frame() image.Image {
 			buffer[off+2] = texs[texY][texNum*texSize+texX][2]
 		}
 
-		g.drawBackground(img, dda, x, wallX, drawEnd)
+		// Timing every column costs about as much as drawing it, only time a sample of them.
+		if x%profilerSample == 0 {
+			bgStart := g.profiler.now()
+			g.drawBackground(img, dda, x, wallX, drawStart, drawEnd, focal)
+			g.profiler.addBackground(g.profiler.since(bgStart) * profilerSample)
+		} else {
+			g.drawBackground(img, dda, x, wallX, drawStart, drawEnd, focal)
+		}
+		g.seeThrough[x] = seeThroughColumn{rayDir: dda.rayDir, hits: dda.seeThrough}
+	}
+	g.drawSprites(img, focal)
+	// What's left is in front of all the sprites.
+	for x := range g.seeThrough {
+		g.drawSeeThrough(img, x, 0, focal)
 	}
 
 	return img
 }
 
-func (g *Game) drawBackground(img *image.RGBA, dda *DDA, x int, wallX float64, drawEnd int) {
+// getTexX returns where exactly the wall was hit and the matching x coordinate on the texture.
+func getTexX(pos, rayDir math2.Point, side bool, perpWallDist float64) (wallX float64, texX int) {
+	// The value wallX represents the exact value where the
+	// wall was hit, not just the integer coordinates of the wall.
+	// This is required to know which x-coordinate of the texture
+	// we have to use.
+	//
+	// This is calculated by first calculating the exact
+	// x or y coordinate in the world, and then subtracting
+	// the integer value of the wall off it.
+	//
+	// Note that even if it's called wallX, it's actually an
+	// y-coordinate of the wall if side==1, but it's always
+	// the x-coordinate of the texture.
+	if !side {
+		wallX = pos.Y + perpWallDist*rayDir.Y
+	} else {
+		wallX = pos.X + perpWallDist*rayDir.X
+	}
+	wallX -= math.Floor(wallX)
+
+	// x coordinate on the texture.
+	texX = int(wallX * texSize)
+	if !side && rayDir.X > 0 {
+		texX = texSize - texX - 1
+	}
+	if side && rayDir.Y < 0 {
+		texX = texSize - texX - 1
+	}
+	return wallX, texX
+}
+
+// seeThroughColumn is the see-through walls crossed by the ray of a screen column.
+type seeThroughColumn struct {
+	rayDir math2.Point
+	hits   []seeThroughHit // Nearest first, the drawn ones are removed from the end.
+}
+
+// drawSeeThrough draws the see-through walls of the column farther than depth on top of it.
+// They are drawn back-to-front so the nearest ones end up on top
+// and the transparent pixels let what's behind show.
+func (g *Game) drawSeeThrough(img *image.RGBA, x int, depth, focal float64) {
+	buffer := img.Pix
+	horizon, eye := g.horizon(), g.eyeZ()
+	col := &g.seeThrough[x]
+	for len(col.hits) > 0 && col.hits[len(col.hits)-1].perpWallDist > depth {
+		hit := col.hits[len(col.hits)-1]
+		col.hits = col.hits[:len(col.hits)-1]
+
+		lineHeight := max(1, int(focal/hit.perpWallDist))
+		top, drawStart, drawEnd := wallSpan(lineHeight, horizon, g.height, eye)
+
+		_, texX := getTexX(g.pos, col.rayDir, hit.side, hit.perpWallDist)
+		texX += g.world[hit.worldPt.Y][hit.worldPt.X].maskedTexNum() * texSize
+
+		texs := &g.maskedTexturesCache
+		if hit.side {
+			texs = &g.maskedSideTexturesCache
+		}
+		for y := drawStart; y < drawEnd; y++ {
+			d := y - top
+			texY := (d * texSize) / lineHeight
+
+			// Skip the transparent pixels.
+			if texs[texY][texX][3] == 0 {
+				continue
+			}
+			off := (y*g.width + x) * 4
+			buffer[off] = texs[texY][texX][0]
+			buffer[off+1] = texs[texY][texX][1]
+			buffer[off+2] = texs[texY][texX][2]
+		}
+	}
+}
+
+// drawBackground draws the floor below the wall and the ceiling above it.
+func (g *Game) drawBackground(img *image.RGBA, dda *DDA, x int, wallX float64, drawStart, drawEnd int, focal float64) {
 	// NOTE: 10fps gain by creating a buffer variable vs using img.Pix directly.
 	buffer := img.Pix
 	var floorWall math2.Point
@@ -165,11 +305,19 @@ func (g *Game) drawBackground(img *image.RGBA, dda *DDA, x int, wallX float64, d
 		floorWall.Y = float64(dda.worldPt.Y) + 1.0
 	}
 
-	distWall, distPlayer := dda.perpWallDist, 0.0
-	for y := drawEnd + 1; y < g.height; y++ {
-		currentDist := float64(g.height) / (2.0*float64(y) - float64(g.height))
+	horizon, eye := g.horizon(), g.eyeZ()
+	floorStart, ceilingEnd := max(drawEnd, horizon+1), min(drawStart, horizon)
+	// Standing, the ceiling row mirroring the floor row around the horizon is at the same distance.
+	mirror := eye == eyeHeight
 
-		weight := (currentDist - distPlayer) / (distWall - distPlayer)
+	// The row distance is the height of the eye above the floor (or below the ceiling)
+	// over the row distance to the horizon, scaled by the focal length.
+	distWall := dda.perpWallDist
+	for y := floorStart; y < g.height; y++ {
+		currentDist := eye * focal / float64(y-horizon)
+
+		// NOTE: Manually inlined backgroundTexel for perf.
+		weight := currentDist / distWall
 
 		currentFloor := math2.Pt(
 			weight*floorWall.X+(1.0-weight)*g.pos.X,
@@ -178,7 +326,12 @@ func (g *Game) drawBackground(img *image.RGBA, dda *DDA, x int, wallX float64, d
 
 		fx := int(currentFloor.X*float64(texSize)) % texSize
 		fy := int(currentFloor.Y*float64(texSize)) % texSize
-		fx2 := fx + (4 * texSize)
+		floorTex, ceilingTex := defaultFloorTex, defaultCeilingTex
+		if cy, cx := int(currentFloor.Y), int(currentFloor.X); cy >= 0 && cy < len(g.world) && cx >= 0 && cx < len(g.world[cy]) {
+			floorTex, ceilingTex = g.world[cy][cx].floorTexNum(), g.world[cy][cx].ceilingTexNum()
+		}
+		fx2 := fx + (ceilingTex * texSize)
+		fx += floorTex * texSize
 
 		// NOTE: 20fps gain by manually inlining.
 		off := (y*g.width + x) * 4
@@ -186,11 +339,47 @@ func (g *Game) drawBackground(img *image.RGBA, dda *DDA, x int, wallX float64, d
 		buffer[off+1] = g.texturesCache[fy][fx][1]
 		buffer[off+2] = g.texturesCache[fy][fx][2]
 
-		off1 := ((g.height-y)*g.width + x) * 4
-		buffer[off1] = g.texturesCache[fy][fx2][0]
-		buffer[off1+1] = g.texturesCache[fy][fx2][1]
-		buffer[off1+2] = g.texturesCache[fy][fx2][2]
+		if y1 := 2*horizon - y; mirror && y1 >= 0 && y1 < ceilingEnd {
+			off1 := (y1*g.width + x) * 4
+			buffer[off1] = g.texturesCache[fy][fx2][0]
+			buffer[off1+1] = g.texturesCache[fy][fx2][1]
+			buffer[off1+2] = g.texturesCache[fy][fx2][2]
+		}
+	}
+
+	// Remaining ceiling rows, all of them when crouching/jumping.
+	if mirror && floorStart < g.height {
+		ceilingEnd = min(ceilingEnd, 2*horizon-(g.height-1))
+	}
+	for y := ceilingEnd - 1; y >= 0; y-- {
+		currentDist := (1 - eye) * focal / float64(horizon-y)
+		fx, fy, _, ceilingTex := g.backgroundTexel(floorWall, distWall, currentDist)
+		fx += ceilingTex * texSize
+
+		off := (y*g.width + x) * 4
+		buffer[off] = g.texturesCache[fy][fx][0]
+		buffer[off+1] = g.texturesCache[fy][fx][1]
+		buffer[off+2] = g.texturesCache[fy][fx][2]
+	}
+}
+
+// backgroundTexel returns the texture coordinates and the floor/ceiling textures
+// of the floor/ceiling point at the given distance, interpolated between the player and the wall.
+func (g *Game) backgroundTexel(floorWall math2.Point, distWall, currentDist float64) (fx, fy, floorTex, ceilingTex int) {
+	weight := currentDist / distWall
+
+	currentFloor := math2.Pt(
+		weight*floorWall.X+(1.0-weight)*g.pos.X,
+		weight*floorWall.Y+(1.0-weight)*g.pos.Y,
+	)
+
+	fx = int(currentFloor.X*float64(texSize)) % texSize
+	fy = int(currentFloor.Y*float64(texSize)) % texSize
+	floorTex, ceilingTex = defaultFloorTex, defaultCeilingTex
+	if cy, cx := int(currentFloor.Y), int(currentFloor.X); cy >= 0 && cy < len(g.world) && cx >= 0 && cx < len(g.world[cy]) {
+		floorTex, ceilingTex = g.world[cy][cx].floorTexNum(), g.world[cy][cx].ceilingTexNum()
 	}
+	return fx, fy, floorTex, ceilingTex
 }
 
 func (g *Game) getTexNum(x, y int) int {
@@ -200,7 +389,18 @@ func (g *Game) getTexNum(x, y int) int {
 	return g.world[y][x].wallType
 }
 
+func (g *Game) isSolid(x, y int) bool {
+	if g.noclip {
+		// Still stay inside the map borders.
+		return y < 1 || y >= len(g.world)-1 || x < 1 || x >= len(g.world[y])-1
+	}
+	return g.world[y][x].solid()
+}
+
 func (g *Game) getColor(x, y int) color.Color {
+	if g.world[y][x].seeThrough() {
+		return color.RGBA{A: 255, R: 120, G: 120, B: 160}
+	}
 	switch g.getTexNum(x, y) {
 	case 1:
 		return color.RGBA{A: 255, R: 255}
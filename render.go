@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// newHeadlessGame creates a game ready to render frames without a window.
+func newHeadlessGame(name string, lvl *level, width, height int) (*Game, error) {
+	front, side, err := loadTextures(textureData)
+	if err != nil {
+		return nil, fmt.Errorf("loadTextures: %w", err)
+	}
+	g := &Game{width: width, height: height}
+	g.setLevel(name, lvl)
+	g.setTextures(front, side)
+	return g, nil
+}
+
+// renderTopDown draws the whole map on a plain image with scale pixels per case,
+// using the minimap colors, as well as the player and its direction.
+func (g *Game) renderTopDown(scale int) *image.RGBA {
+	worldWidth, worldHeight := len(g.world[0]), len(g.world)
+	img := image.NewRGBA(image.Rect(0, 0, worldWidth*scale, worldHeight*scale))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	for y := 0; y < worldHeight; y++ {
+		for x := 0; x < worldWidth; x++ {
+			r := image.Rect(x*scale, y*scale, (x+1)*scale, (y+1)*scale)
+			if c, ok := g.minimapCaseColor(x, y, nil); ok {
+				draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+			}
+			if g.showMinimapGrid {
+				for i := 0; i < scale; i++ {
+					img.Set(r.Min.X+i, r.Min.Y, color.White)
+					img.Set(r.Min.X, r.Min.Y+i, color.White)
+				}
+			}
+		}
+	}
+
+	// Player as a red disk with a line in its direction.
+	red := color.RGBA{A: 255, R: 255}
+	spos := g.pos.Scale(float64(scale))
+	radius := max(1, float64(scale)/4)
+	for y := int(spos.Y - radius); y <= int(spos.Y+radius); y++ {
+		for x := int(spos.X - radius); x <= int(spos.X+radius); x++ {
+			if math.Hypot(float64(x)+0.5-spos.X, float64(y)+0.5-spos.Y) <= radius {
+				img.Set(x, y, red)
+			}
+		}
+	}
+	dir := g.dir.Scale(1 / g.dir.Norm())
+	for i := 0; i < scale; i++ {
+		pt := spos.Add(dir.Scale(float64(i)))
+		img.Set(int(pt.X), int(pt.Y), red)
+	}
+	return img
+}
+
+// cmdRender renders the given map file to a PNG, either top-down or in first person.
+func cmdRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	out := fs.String("o", "", "Output PNG file, stdout if empty.")
+	view := fs.Bool("view", false, "Render a first person frame instead of the top-down map.")
+	scale := fs.Int("scale", 16, "Top-down: pixels per case.")
+	grid := fs.Bool("grid", false, "Top-down: draw the grid.")
+	x := fs.Float64("x", 0, "Player X position. Defaults to the spawn.")
+	y := fs.Float64("y", 0, "Player Y position. Defaults to the spawn.")
+	angle := fs.Float64("angle", 0, "Player direction in degrees, 0 facing east. Defaults to the spawn direction.")
+	width := fs.Int("width", 640, "First person: frame width.")
+	height := fs.Int("height", 480, "First person: frame height.")
+	fov := fs.Float64("fov", defaultFOV(), "First person: horizontal field of view in degrees.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: render [flags] <map file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing map file")
+	}
+	if *scale < 1 || *width < 1 || *height < 1 {
+		return errors.New("scale, width and height must be positive")
+	}
+
+	buf, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("readFile: %w", err)
+	}
+	lvl, err := parseLevelFile(fs.Arg(0), buf)
+	if err != nil {
+		return fmt.Errorf("parseLevelFile: %w", err)
+	}
+	g, err := newHeadlessGame(path.Base(fs.Arg(0)), lvl, *width, *height)
+	if err != nil {
+		return err
+	}
+	g.showMinimapGrid = *grid
+	if err := g.setFOV(*fov); err != nil {
+		return err
+	}
+
+	// Override the spawn with the given flags.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "x":
+			g.pos.X = *x
+		case "y":
+			g.pos.Y = *y
+		case "angle":
+			g.dir = math2.Pt(1, 0).Rotate(math2.NewDegAngle(*angle))
+			g.updatePlane()
+		}
+	})
+	if int(g.pos.Y) < 0 || int(g.pos.Y) >= len(g.world) || int(g.pos.X) < 0 || int(g.pos.X) >= len(g.world[int(g.pos.Y)]) {
+		return fmt.Errorf("position %s out of the map", g.pos)
+	}
+
+	var img image.Image
+	if *view {
+		frame, _ := g.frame().(*image.RGBA) // Always RGBA.
+		// The frame doesn't set the alpha channel, which is ignored when drawn on the screen.
+		for i := 3; i < len(frame.Pix); i += 4 {
+			frame.Pix[i] = 0xff
+		}
+		img = frame
+	} else {
+		img = g.renderTopDown(*scale)
+	}
+
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		return fmt.Errorf("png.Encode: %w", err)
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(pngBuf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(*out, pngBuf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("writeFile: %w", err)
+	}
+	return nil
+}
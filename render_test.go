@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testRenderMap = `@spawn 1.5 1.5
+1 1 1 1 1
+1 0 0 0 2
+1 1 1 1 1
+`
+
+func TestRenderTopDown(t *testing.T) {
+	t.Parallel()
+
+	lvl, err := parseLevel([]byte(testRenderMap))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{}
+	g.setLevel("test", lvl)
+	img := g.renderTopDown(8)
+
+	if expect, got := 5*8, img.Bounds().Dx(); expect != got {
+		t.Fatalf("unexpected width:\nexpect:\t%d\ngot:\t%d", expect, got)
+	}
+	for _, tc := range []struct {
+		x, y  int
+		color color.Color
+	}{
+		{4, 4, g.getColor(0, 0)},                 // Wall.
+		{4*8 + 4, 8 + 4, g.getColor(4, 1)},       // Other wall type.
+		{3*8 + 4, 8 + 4, color.RGBA{A: 255}},     // Empty.
+		{12, 12, color.RGBA{A: 255, R: 255}},     // Player.
+		{12 + 6, 12, color.RGBA{A: 255, R: 255}}, // Player direction.
+	} {
+		if got := img.At(tc.x, tc.y); got != tc.color {
+			t.Errorf("unexpected color at %d/%d:\nexpect:\t%v\ngot:\t%v", tc.x, tc.y, tc.color, got)
+		}
+	}
+}
+
+func TestCmdRender(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	mapFile := filepath.Join(dir, "map")
+	if err := os.WriteFile(mapFile, []byte(testRenderMap), 0o600); err != nil {
+		t.Fatalf("writeFile: %s", err)
+	}
+
+	for _, tc := range []struct {
+		args          []string
+		width, height int
+		wall          image.Point // Pixel expected to be on a wall.
+	}{
+		{[]string{"-scale", "4"}, 20, 12, image.Pt(1, 1)},
+		{[]string{"-view", "-width", "64", "-height", "48", "-x", "2.5", "-angle", "0"}, 64, 48, image.Pt(32, 24)},
+	} {
+		out := filepath.Join(dir, "out.png")
+		if err := cmdRender(append(tc.args, "-o", out, mapFile)); err != nil {
+			t.Fatalf("cmdRender %v: %s", tc.args, err)
+		}
+		buf, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("readFile: %s", err)
+		}
+		img, err := png.Decode(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("png.Decode: %s", err)
+		}
+		if img.Bounds().Dx() != tc.width || img.Bounds().Dy() != tc.height {
+			t.Errorf("%v: unexpected size: %v", tc.args, img.Bounds())
+		}
+		if r, g, b, _ := img.At(tc.wall.X, tc.wall.Y).RGBA(); r == 0 && g == 0 && b == 0 {
+			t.Errorf("%v: unexpected black wall at %v", tc.args, tc.wall)
+		}
+	}
+
+	if err := cmdRender([]string{"-x", "10", mapFile}); err == nil {
+		t.Error("position out of the map should fail")
+	}
+}
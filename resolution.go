@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Render scale settings.
+const (
+	minRenderScale = 0.25
+	maxRenderScale = 2.0
+
+	dynamicStep     = 0.05                  // Scale change per adjustment.
+	dynamicCooldown = 30                    // Frames between adjustments, letting the average settle.
+	dynamicTarget   = 12 * time.Millisecond // Default frame render time target, leaving room for the rest of the frame at 60fps.
+)
+
+// dynamicResolution adjusts the render scale to keep the frame render time around the target.
+type dynamicResolution struct {
+	enabled  bool
+	target   time.Duration
+	avg      time.Duration // Exponential moving average of the frame render time.
+	cooldown int           // Frames left before the next adjustment.
+}
+
+// screenSize returns the logical screen size, where the frame is upscaled and the HUD drawn.
+// Defaults to the render resolution.
+func (g *Game) screenSize() (width, height int) {
+	if g.screenWidth == 0 || g.screenHeight == 0 {
+		return g.width, g.height
+	}
+	return g.screenWidth, g.screenHeight
+}
+
+// renderScaleValue returns the render scale, 1 when not set.
+func (g *Game) renderScaleValue() float64 {
+	if g.renderScale == 0 {
+		return 1
+	}
+	return g.renderScale
+}
+
+// setRenderScale changes the render resolution to the given fraction of the screen size.
+func (g *Game) setRenderScale(scale float64) error {
+	if scale < minRenderScale || scale > maxRenderScale || math.IsNaN(scale) {
+		return fmt.Errorf("render scale %g out of range, expect %g to %g", scale, minRenderScale, maxRenderScale)
+	}
+	g.screenWidth, g.screenHeight = g.screenSize()
+	g.renderScale = scale
+	g.width = max(1, int(math.Round(float64(g.screenWidth)*scale)))
+	g.height = max(1, int(math.Round(float64(g.screenHeight)*scale)))
+	return nil
+}
+
+// adjustResolution updates the render scale from the last frame render time, when the dynamic mode is enabled.
+// The scale goes down as soon as the frames are too slow, and back up only with a good margin to avoid oscillating.
+func (g *Game) adjustResolution(frameTime time.Duration) {
+	d := &g.dynamicRes
+	if !d.enabled {
+		return
+	}
+	if d.target == 0 {
+		d.target = dynamicTarget
+	}
+	if d.avg == 0 {
+		d.avg = frameTime
+	}
+	d.avg += (frameTime - d.avg) / 8
+
+	if d.cooldown > 0 {
+		d.cooldown--
+		return
+	}
+	scale := g.renderScaleValue()
+	switch {
+	case d.avg > d.target && scale > minRenderScale:
+		scale = max(minRenderScale, scale-dynamicStep)
+	case d.avg < d.target*6/10 && scale < 1:
+		// The dynamic mode doesn't supersample.
+		scale = min(1, scale+dynamicStep)
+	default:
+		return
+	}
+	_ = g.setRenderScale(scale) // Can't fail, in range.
+	d.cooldown = dynamicCooldown
+	// The render time changes with the scale.
+	d.avg = 0
+}
+
+// parseFilter returns the upscale filter from its name.
+func parseFilter(name string) (ebiten.Filter, error) {
+	switch name {
+	case "nearest":
+		return ebiten.FilterNearest, nil
+	case "linear":
+		return ebiten.FilterLinear, nil
+	default:
+		return 0, fmt.Errorf("unknown filter %q, expect nearest or linear", name)
+	}
+}
+
+// filterName returns the name of the upscale filter.
+func filterName(f ebiten.Filter) string {
+	if f == ebiten.FilterLinear {
+		return "linear"
+	}
+	return "nearest"
+}
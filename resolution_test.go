@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestRenderScale(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newSimGame(t)
+	g.explored = newExploredSet(g.world)
+	g.width, g.height = 320, 200
+
+	for _, tc := range []struct {
+		scale         float64
+		width, height int
+	}{
+		{0.5, 160, 100},
+		{0.25, 80, 50},
+		{2, 640, 400},
+		{1, 320, 200},
+	} {
+		if err := g.setRenderScale(tc.scale); err != nil {
+			t.Fatalf("setRenderScale: %s", err)
+		}
+		if g.width != tc.width || g.height != tc.height {
+			t.Errorf("scale %g: unexpected render size %dx%d", tc.scale, g.width, g.height)
+		}
+		// The screen stays the same.
+		if w, h := g.screenSize(); w != 320 || h != 200 {
+			t.Errorf("scale %g: unexpected screen size %dx%d", tc.scale, w, h)
+		}
+		if img := g.frame(); img.Bounds() != image.Rect(0, 0, tc.width, tc.height) {
+			t.Errorf("scale %g: unexpected frame size %v", tc.scale, img.Bounds())
+		}
+	}
+	for _, scale := range []float64{0, 0.2, 2.5} {
+		if err := g.setRenderScale(scale); err == nil {
+			t.Errorf("scale %g should fail", scale)
+		}
+	}
+
+	if err := g.exec("renderScale 50; renderFilter linear"); err != nil {
+		t.Fatalf("exec: %s", err)
+	}
+	if g.width != 160 || filterName(g.renderFilter) != "linear" {
+		t.Errorf("unexpected settings: %d %s", g.width, filterName(g.renderFilter))
+	}
+}
+
+func TestDynamicResolution(t *testing.T) {
+	t.Parallel()
+
+	g := &Game{width: 320, height: 200}
+	g.dynamicRes = dynamicResolution{enabled: true, target: 10 * time.Millisecond}
+
+	// Slow frames: the scale goes down to the minimum.
+	for i := 0; i < 1000; i++ {
+		g.adjustResolution(30 * time.Millisecond)
+	}
+	if g.renderScale != minRenderScale || g.width != 80 {
+		t.Fatalf("unexpected scale after slow frames: %g %d", g.renderScale, g.width)
+	}
+
+	// Frames around the target: the scale is stable.
+	for i := 0; i < 1000; i++ {
+		g.adjustResolution(8 * time.Millisecond)
+	}
+	if g.renderScale != minRenderScale {
+		t.Fatalf("the scale should be stable near the target: %g", g.renderScale)
+	}
+
+	// Fast frames: back to full resolution, without supersampling.
+	for i := 0; i < 1000; i++ {
+		g.adjustResolution(time.Millisecond)
+	}
+	if g.renderScale != 1 || g.width != 320 || g.height != 200 {
+		t.Fatalf("unexpected scale after fast frames: %g %dx%d", g.renderScale, g.width, g.height)
+	}
+
+	// Disabled: nothing changes.
+	g.dynamicRes.enabled = false
+	g.adjustResolution(time.Second)
+	if g.renderScale != 1 {
+		t.Fatalf("the scale should not change when disabled: %g", g.renderScale)
+	}
+}
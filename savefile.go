@@ -0,0 +1,51 @@
+//go:build !js
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// saveFile writes the file to disk, creating the parent directories.
+func saveFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("mkdirAll: %w", err)
+	}
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		return fmt.Errorf("writeFile: %w", err)
+	}
+	return nil
+}
+
+// saveSlotPath returns the file of the quick-save slot, in the user config directory.
+func saveSlotPath(slot int) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("userConfigDir: %w", err)
+	}
+	return filepath.Join(dir, "wolf3d", "saves", fmt.Sprintf("slot%d.json", slot)), nil
+}
+
+// writeSaveSlot stores the game state in the given quick-save slot.
+func writeSaveSlot(slot int, data []byte) error {
+	name, err := saveSlotPath(slot)
+	if err != nil {
+		return err
+	}
+	return saveFile(name, data)
+}
+
+// readSaveSlot returns the game state stored in the given quick-save slot.
+func readSaveSlot(slot int) ([]byte, error) {
+	name, err := saveSlotPath(slot)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("readFile: %w", err)
+	}
+	return buf, nil
+}
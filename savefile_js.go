@@ -0,0 +1,56 @@
+//go:build js
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"syscall/js"
+)
+
+// saveFile triggers a browser download of the file.
+func saveFile(name string, data []byte) error {
+	buf := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(buf, data)
+
+	blob := js.Global().Get("Blob").New([]any{buf})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+
+	a := js.Global().Get("document").Call("createElement", "a")
+	a.Set("href", url)
+	a.Set("download", path.Base(name))
+	a.Call("click")
+
+	// Give the browser time to start the download before releasing the blob.
+	var revoke js.Func
+	revoke = js.FuncOf(func(js.Value, []js.Value) any {
+		js.Global().Get("URL").Call("revokeObjectURL", url)
+		revoke.Release()
+		return nil
+	})
+	js.Global().Call("setTimeout", revoke, 1000)
+	return nil
+}
+
+func saveSlotKey(slot int) string { return fmt.Sprintf("wolf3d/slot%d", slot) }
+
+// writeSaveSlot stores the game state in the given quick-save slot, in the browser local storage.
+func writeSaveSlot(slot int, data []byte) (err error) {
+	// setItem throws when the storage is full or disabled.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("localStorage: %v", r)
+		}
+	}()
+	js.Global().Get("localStorage").Call("setItem", saveSlotKey(slot), string(data))
+	return nil
+}
+
+// readSaveSlot returns the game state stored in the given quick-save slot.
+func readSaveSlot(slot int) ([]byte, error) {
+	v := js.Global().Get("localStorage").Call("getItem", saveSlotKey(slot))
+	if v.Type() != js.TypeString {
+		return nil, fmt.Errorf("slot %d is empty", slot)
+	}
+	return []byte(v.String()), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Save file settings.
+const (
+	saveVersion  = 2 // Bumped on incompatible changes of saveState.
+	saveMaxSlots = 9
+)
+
+// saveState is the full game state, as stored in save files.
+type saveState struct {
+	Version int `json:"version"`
+
+	Map   string `json:"map"`
+	Level string `json:"level"` // World, spawn and objects in the map format, to keep the edits.
+	State string `json:"state"` // World and objects left while playing, in the map format.
+
+	Pos   math2.Point `json:"pos"`
+	Dir   math2.Point `json:"dir"`
+	Plane math2.Point `json:"plane"`
+
+	Explored exploredSet `json:"explored"`
+	Fired    []bool      `json:"fired,omitempty"` // Fired once triggers, by index.
+
+	Stats    levelStats        `json:"stats"`
+	Campaign *campaignProgress `json:"campaign,omitempty"`
+
+	MapMod             int  `json:"map_mod"`
+	MinimapZoom        int  `json:"minimap_zoom"`
+	ShowRays           bool `json:"show_rays"`
+	ShowHighlight      bool `json:"show_highlight"`
+	ShowMinimapGrid    bool `json:"show_minimap_grid"`
+	HideInvisibleWalls bool `json:"hide_invisible_walls"`
+	FogOfWar           bool `json:"fog_of_war"`
+}
+
+// marshalState encodes the game state.
+func (g *Game) marshalState() ([]byte, error) {
+	lvl := &level{world: g.world, spawn: g.pos}
+	if g.lvl != nil {
+		lvl = g.lvl
+	}
+	buf, err := json.MarshalIndent(saveState{
+		Version: saveVersion,
+
+		Map:   g.mapName,
+		Level: string(formatLevel(lvl)),
+		State: string(formatLevel(&level{world: g.world, objects: g.objects})),
+
+		Pos:   g.pos,
+		Dir:   g.dir,
+		Plane: g.plane,
+
+		Explored: g.explored,
+		Fired:    g.firedTriggers(),
+
+		Stats:    g.stats,
+		Campaign: g.campaign,
+
+		MapMod:             g.mapMod,
+		MinimapZoom:        g.minimapZoom,
+		ShowRays:           g.showRays,
+		ShowHighlight:      g.showHighlight,
+		ShowMinimapGrid:    g.showMinimapGrid,
+		HideInvisibleWalls: g.hideInvisibleWalls,
+		FogOfWar:           g.fogOfWar,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	return buf, nil
+}
+
+// unmarshalState restores the game state encoded by marshalState.
+// The game is left untouched on error.
+func (g *Game) unmarshalState(data []byte) error {
+	var s saveState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if s.Version != saveVersion {
+		return fmt.Errorf("unsupported save version %d, expected %d", s.Version, saveVersion)
+	}
+	lvl, err := parseLevel([]byte(s.Level))
+	if err != nil {
+		return fmt.Errorf("parseLevel: %w", err)
+	}
+	state, err := parseLevel([]byte(s.State))
+	if err != nil {
+		return fmt.Errorf("parseLevel state: %w", err)
+	}
+	if len(state.world) != len(lvl.world) || len(state.world[0]) != len(lvl.world[0]) {
+		return fmt.Errorf("state world is %dx%d, expected %dx%d", len(state.world[0]), len(state.world), len(lvl.world[0]), len(lvl.world))
+	}
+	if len(s.Explored) != len(lvl.world) {
+		return fmt.Errorf("explored set has %d rows, expected %d", len(s.Explored), len(lvl.world))
+	}
+	def := g.campaignDef
+	if s.Campaign != nil {
+		if def == nil {
+			if def, err = defaultCampaign(); err != nil {
+				return err
+			}
+		}
+		if s.Campaign.Episode < 0 || s.Campaign.Episode >= len(def.episodes) ||
+			s.Campaign.Level < 0 || s.Campaign.Level >= len(def.episodes[s.Campaign.Episode].levels) {
+			return fmt.Errorf("campaign level %d/%d out of range", s.Campaign.Episode+1, s.Campaign.Level+1)
+		}
+	}
+
+	g.setLevel(s.Map, lvl)
+	g.world, g.objects = state.world, state.objects
+	g.pos, g.dir, g.plane = s.Pos, s.Dir, s.Plane
+	g.fov = 2 * math.Atan(s.Plane.Norm()) * 180 / math.Pi
+	g.explored = s.Explored
+	g.resetTriggers()
+	for i, fired := range s.Fired {
+		if i < len(g.triggers) {
+			g.triggers[i].done = fired
+		}
+	}
+	g.stats = s.Stats
+	g.campaign, g.campaignDef = s.Campaign, def
+
+	g.mapMod = s.MapMod
+	g.minimapZoom = clampMinimapZoom(s.MinimapZoom)
+	g.showRays = s.ShowRays
+	g.showHighlight = s.ShowHighlight
+	g.showMinimapGrid = s.ShowMinimapGrid
+	g.hideInvisibleWalls = s.HideInvisibleWalls
+	g.fogOfWar = s.FogOfWar
+	return nil
+}
+
+// quickSave stores the game state in the given slot.
+func (g *Game) quickSave(slot int) error {
+	buf, err := g.marshalState()
+	if err != nil {
+		return err
+	}
+	if err := writeSaveSlot(slot, buf); err != nil {
+		return fmt.Errorf("writeSaveSlot %d: %w", slot, err)
+	}
+	return nil
+}
+
+// quickLoad restores the game state from the given slot.
+// Refused while recording or playing a demo, which only replay the player actions.
+func (g *Game) quickLoad(slot int) error {
+	if g.inDemo() {
+		return errDemoRunning
+	}
+	buf, err := readSaveSlot(slot)
+	if err != nil {
+		return fmt.Errorf("readSaveSlot %d: %w", slot, err)
+	}
+	return g.unmarshalState(buf)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestSaveState(t *testing.T) {
+	t.Parallel()
+
+	lvl, err := parseLevel([]byte("@spawn 1.5 1.5\n@object key 2.5 1.5 color=gold\n1 1 1 1\n1 0 0 1\n1 1 1 1\n"))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{width: 32, height: 24}
+	g.setLevel("test", lvl)
+	g.moveForward(0.3)
+	g.turnLeft(0.123456789)
+	_ = g.frame()
+	g.editorPaint(image.Pt(2, 1), 3)
+	g.editorEndStroke()
+	// Changes made while playing.
+	g.removeObject(0)
+	g.world[1][2].wallType = wallBars | wallPassable
+	g.mapMod, g.minimapZoom, g.fogOfWar, g.showRays = 2, 32, true, true
+
+	buf, err := g.marshalState()
+	if err != nil {
+		t.Fatalf("marshalState: %s", err)
+	}
+
+	g2 := &Game{width: 32, height: 24}
+	g2.setLevel("other", &level{world: [][]MapPoint{{{}}}})
+	if err := g2.unmarshalState(buf); err != nil {
+		t.Fatalf("unmarshalState: %s", err)
+	}
+	// Exact view.
+	if g.pos != g2.pos || g.dir != g2.dir || g.plane != g2.plane {
+		t.Errorf("unexpected view:\nexpect:\t%#v %#v %#v\ngot:\t%#v %#v %#v", g.pos, g.dir, g.plane, g2.pos, g2.dir, g2.plane)
+	}
+	if g2.mapName != "test" || g2.mapMod != 2 || g2.minimapZoom != 32 || !g2.fogOfWar || !g2.showRays || g2.showHighlight {
+		t.Errorf("unexpected state: %+v", g2)
+	}
+	if g2.lvl.world[1][2].wallType != 3 {
+		t.Error("edited world not restored")
+	}
+	if g2.world[1][2].wallType != wallBars|wallPassable {
+		t.Error("played world not restored")
+	}
+	if len(g2.lvl.objects) != 1 || g2.lvl.objects[0].props["color"] != "gold" {
+		t.Errorf("unexpected level objects: %+v", g2.lvl.objects)
+	}
+	if len(g2.objects) != 0 {
+		t.Errorf("picked up object restored: %+v", g2.objects)
+	}
+	if !g2.explored.has(3, 1) || g2.explored.has(0, 1) {
+		t.Error("explored set not restored")
+	}
+	expect, _ := g.frame().(*image.RGBA) // Always RGBA.
+	got, _ := g2.frame().(*image.RGBA)   // Always RGBA.
+	if !bytes.Equal(expect.Pix, got.Pix) {
+		t.Error("restored view renders a different frame")
+	}
+}
+
+func TestSaveStateErrors(t *testing.T) {
+	t.Parallel()
+
+	g := &Game{}
+	g.setLevel("test", &level{world: [][]MapPoint{{{}}}, spawn: math2.Pt(0.5, 0.5)})
+	buf, err := g.marshalState()
+	if err != nil {
+		t.Fatalf("marshalState: %s", err)
+	}
+	for name, data := range map[string]string{
+		"version":  strings.Replace(string(buf), `"version": 2`, `"version": 99`, 1),
+		"level":    strings.Replace(string(buf), `"level": "`, `"level": "zz `, 1),
+		"state":    strings.Replace(string(buf), `"state": "`, `"state": "zz `, 1),
+		"explored": strings.Replace(string(buf), `"explored": ".\n"`, `"explored": ".\n.\n"`, 1),
+		"json":     "{",
+	} {
+		if err := g.unmarshalState([]byte(data)); err == nil {
+			t.Errorf("[%s] expected an error", name)
+		}
+	}
+	if g.mapName != "test" {
+		t.Error("failed load should leave the game untouched")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errServerClosed is returned by the server once closed.
+var errServerClosed = errors.New("server closed") //nolint:gochecknoglobals // Sentinel error.
+
+// serverPlayer is a player connected to the server.
+type serverPlayer struct {
+	id    int
+	name  string
+	conn  netConn
+	game  *Game // Simulation state, sharing the server world.
+	input actions
+	out   chan *netMessage // States to send, dropped when the client is too slow.
+}
+
+// server is the authoritative multiplayer server: it runs the simulation from the clients inputs.
+type server struct {
+	mapName string
+	lvl     *level
+
+	mu      sync.Mutex
+	players map[int]*serverPlayer
+	nextID  int
+	tick    uint64
+	closed  bool
+
+	listeners []net.Listener
+	done      chan struct{}
+}
+
+func newServer(mapName string, lvl *level) *server {
+	return &server{
+		mapName: mapName,
+		lvl:     lvl,
+		players: map[int]*serverPlayer{},
+		nextID:  1,
+		done:    make(chan struct{}),
+	}
+}
+
+// serve accepts the TCP clients until the listener fails or the server is closed.
+func (s *server) serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return errServerClosed
+			default:
+				return fmt.Errorf("accept: %w", err)
+			}
+		}
+		go s.handle(newStreamConn(c))
+	}
+}
+
+// serveWebSocket accepts the WebSocket clients on /ws, for the browsers, until the listener fails or the server is closed.
+func (s *server) serveWebSocket(l net.Listener) error {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, l)
+	s.mu.Unlock()
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws", s)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.Serve(l); err != nil {
+		select {
+		case <-s.done:
+			return errServerClosed
+		default:
+			return fmt.Errorf("serve: %w", err)
+		}
+	}
+	return nil
+}
+
+// ServeHTTP upgrades the request to a WebSocket and handles the client.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := acceptWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	s.handle(c)
+}
+
+// handle runs the connection of a client until it disconnects.
+func (s *server) handle(c netConn) {
+	defer func() { _ = c.Close() }() // Best effort.
+
+	join, err := expectMessage(c, netMsgJoin)
+	if err != nil {
+		return
+	}
+	p, err := s.addPlayer(join.Name, c)
+	if err != nil {
+		return
+	}
+	defer s.removePlayer(p.id)
+
+	// Writer, dropping the connection on error.
+	go func() {
+		for msg := range p.out {
+			if err := c.send(msg); err != nil {
+				_ = c.Close() // Best effort, unblocks the reader.
+				return
+			}
+		}
+	}()
+
+	for {
+		msg, err := c.recv()
+		if err != nil {
+			return
+		}
+		if msg.Type != netMsgInput {
+			continue
+		}
+		s.mu.Lock()
+		p.input = msg.Actions & movementActions
+		s.mu.Unlock()
+	}
+}
+
+func (s *server) addPlayer(name string, c netConn) (*serverPlayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errServerClosed
+	}
+
+	// Each player gets its own copy of the level, kept as-is as the level events are disabled.
+	lvl, err := parseLevel(formatLevel(s.lvl))
+	if err != nil {
+		return nil, fmt.Errorf("parseLevel: %w", err)
+	}
+	g := &Game{networked: true}
+	g.setLevel(s.mapName, lvl)
+	p := &serverPlayer{
+		id:   s.nextID,
+		name: name,
+		conn: c,
+		game: g,
+		out:  make(chan *netMessage, 16),
+	}
+	if p.name == "" {
+		p.name = fmt.Sprintf("player%d", p.id)
+	}
+	s.nextID++
+	p.out <- &netMessage{Type: netMsgWelcome, ID: p.id, Map: s.mapName, Level: string(formatLevel(s.lvl))}
+	s.players[p.id] = p
+	return p, nil
+}
+
+func (s *server) removePlayer(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.players[id]; ok {
+		close(p.out)
+		delete(s.players, id)
+	}
+}
+
+// update runs a simulation tick and broadcasts the players states.
+func (s *server) update() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tick++
+	state := &netMessage{Type: netMsgState, Tick: s.tick}
+	for _, p := range s.players {
+		if err := p.game.step(p.input); err != nil {
+			return fmt.Errorf("step player %d: %w", p.id, err)
+		}
+		state.Players = append(state.Players, netPlayer{ID: p.id, Name: p.name, Pos: p.game.pos, Dir: p.game.dir, Plane: p.game.plane})
+	}
+	sort.Slice(state.Players, func(i, j int) bool { return state.Players[i].ID < state.Players[j].ID })
+
+	for _, p := range s.players {
+		select {
+		case p.out <- state:
+		default: // Client too slow, it will get the next state.
+		}
+	}
+	return nil
+}
+
+// run updates the server at the simulation tick rate until closed.
+func (s *server) run() error {
+	ticker := time.NewTicker(tickDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return errServerClosed
+		case <-ticker.C:
+			if err := s.update(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Close stops the server and disconnects the clients.
+func (s *server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	var errs []error
+	for _, l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+	for _, p := range s.players {
+		errs = append(errs, p.conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// loadLevelArg loads the level from the embedded maps or from the given file.
+func loadLevelArg(name string) (string, *level, error) {
+	buf, err := mapData.ReadFile(name)
+	if err != nil {
+		if buf, err = os.ReadFile(name); err != nil {
+			return "", nil, fmt.Errorf("readFile: %w", err)
+		}
+	}
+	lvl, err := parseLevelFile(name, buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("parseLevelFile: %w", err)
+	}
+	return strings.TrimPrefix(name, "maps/"), lvl, nil
+}
+
+// cmdServer runs a headless multiplayer server.
+func cmdServer(args []string) error {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	addr := fs.String("addr", ":7777", "TCP address to listen on.")
+	wsAddr := fs.String("ws", "", "Optional HTTP address to listen on for WebSocket clients (browsers), i.e. :8081.")
+	mapName := fs.String("map", "maps/map4", "Embedded map name or map file.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	name, lvl, err := loadLevelArg(*mapName)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	s := newServer(name, lvl)
+	defer func() { _ = s.Close() }() // Best effort.
+	log.Printf("Serving %s on %s", name, l.Addr())
+
+	errCh := make(chan error, 3)
+	go func() { errCh <- s.serve(l) }()
+	if *wsAddr != "" {
+		wl, err := net.Listen("tcp", *wsAddr)
+		if err != nil {
+			return fmt.Errorf("listen websocket: %w", err)
+		}
+		log.Printf("Serving %s on ws://%s/ws", name, wl.Addr())
+		go func() { errCh <- s.serveWebSocket(wl) }()
+	}
+	go func() { errCh <- s.run() }()
+	return <-errCh
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Simulation settings.
+const (
+	tickRate     = 60
+	tickDuration = time.Second / tickRate
+	maxTicks     = 8 // Maximum ticks per update, dropping the time beyond to avoid a spiral of death on slow machines.
+
+	moveSpeed = 3.5 // Cases per second.
+	turnSpeed = 1.2 // Radians per second.
+)
+
+// actions is the set of player inputs for a simulation tick.
+type actions uint32
+
+// Held actions, applied on every tick while the key is pressed.
+const (
+	actForward actions = 1 << iota
+	actBackward
+	actStrafeLeft
+	actStrafeRight
+	actTurnLeft
+	actTurnRight
+
+	// One-shot actions, applied once on the next tick.
+	actToggleGrid
+	actToggleInvisibleWalls
+	actToggleFog
+	actToggleRays
+	actToggleHighlight
+	actCycleMinimap
+	actZoomIn
+	actZoomOut
+	actNextMap
+
+	// Added after the one-shot actions to keep the recorded demos valid.
+	actLookUp
+	actLookDown
+	actCrouch
+	actJump       // One-shot.
+	actCenterView // One-shot.
+	actUse        // One-shot.
+)
+
+// movementActions are the actions moving the player.
+const movementActions = actForward | actBackward | actStrafeLeft | actStrafeRight | actTurnLeft | actTurnRight
+
+// oneShotActions are the actions queued until the next tick.
+const oneShotActions = actToggleGrid | actToggleInvisibleWalls | actToggleFog | actToggleRays | actToggleHighlight |
+	actCycleMinimap | actZoomIn | actZoomOut | actNextMap | actJump | actCenterView | actUse
+
+// now returns the current time from the injected clock, defaulting to the wall clock.
+func (g *Game) now() time.Time {
+	if g.clock != nil {
+		return g.clock()
+	}
+	return time.Now()
+}
+
+// advance runs the simulation ticks elapsed since the last call.
+// Held actions apply to all the ticks, one-shot actions are queued for the next tick.
+// Returns the number of ticks run.
+func (g *Game) advance(input actions) (int, error) {
+	g.pending |= input & oneShotActions
+	held := input &^ oneShotActions
+
+	now := g.now()
+	if g.last.IsZero() {
+		g.last = now
+	}
+	if now.Sub(g.last) > maxTicks*tickDuration {
+		g.last = now.Add(-maxTicks * tickDuration)
+	}
+	n := 0
+	for now.Sub(g.last) >= tickDuration {
+		g.last = g.last.Add(tickDuration)
+		a := held | g.pending
+		g.pending = 0
+		if g.playback != nil {
+			// The demo drives the game instead of the player.
+			var ok bool
+			if a, ok = g.playback.next(); !ok {
+				g.playback = nil
+				g.message = "Demo finished"
+			}
+		}
+		if err := g.step(a); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// step advances the state by one tick. Only depends on the state and the given actions.
+func (g *Game) step(a actions) error {
+	g.tick++
+	dt := tickDuration.Seconds()
+	walked := g.effects.walked
+	if g.recording != nil {
+		g.recording.record(a)
+	}
+	if g.campaign != nil && g.campaign.Intermission {
+		// The level is over, waiting for the player to continue.
+		if a&(actUse|actJump) != 0 {
+			if err := g.nextLevel(); err != nil {
+				return fmt.Errorf("nextLevel: %w", err)
+			}
+		}
+		return nil
+	}
+	g.stats.Ticks++
+
+	if a&actToggleGrid != 0 {
+		g.showMinimapGrid = !g.showMinimapGrid
+	}
+	if a&actToggleInvisibleWalls != 0 {
+		g.hideInvisibleWalls = !g.hideInvisibleWalls
+	}
+	if a&actToggleFog != 0 {
+		g.fogOfWar = !g.fogOfWar
+	}
+	if a&actToggleRays != 0 {
+		g.showRays = !g.showRays
+	}
+	if a&actToggleHighlight != 0 {
+		g.showHighlight = !g.showHighlight
+	}
+	if a&actCycleMinimap != 0 {
+		// -1 -> 0 -> 1 -> 2 -> -1.
+		g.mapMod = (g.mapMod+2)%4 - 1
+	}
+	if a&actZoomIn != 0 {
+		g.minimapZoom = clampMinimapZoom(g.minimapZoom * 2)
+	}
+	if a&actZoomOut != 0 {
+		g.minimapZoom = clampMinimapZoom(g.minimapZoom / 2)
+	}
+	if a&actNextMap != 0 {
+		if err := g.nextMap(); err != nil {
+			return fmt.Errorf("nextMap: %w", err)
+		}
+	}
+
+	if a&actForward != 0 {
+		g.moveForward(moveSpeed * dt)
+	}
+	if a&actStrafeLeft != 0 {
+		g.moveLeft(moveSpeed * dt)
+	}
+	if a&actBackward != 0 {
+		g.moveBackwards(moveSpeed * dt)
+	}
+	if a&actStrafeRight != 0 {
+		g.moveRight(moveSpeed * dt)
+	}
+	if a&actTurnRight != 0 {
+		g.turnRight(turnSpeed * dt)
+	}
+	if a&actTurnLeft != 0 {
+		g.turnLeft(turnSpeed * dt)
+	}
+	g.stepCamera(a, dt)
+	g.stepEffects(walked, dt)
+	if g.networked {
+		// The level events are not synced between the server and the clients yet.
+		return nil
+	}
+	g.pickUp()
+	if a&actUse != 0 {
+		g.attack()
+	}
+	if err := g.runTriggers(a&actUse != 0); err != nil {
+		return fmt.Errorf("runTriggers: %w", err)
+	}
+	return nil
+}
+
+// nextMap skips to the next level of the campaign, or loads the next embedded map outside of a campaign.
+func (g *Game) nextMap() error {
+	if g.campaign != nil {
+		return g.nextLevel()
+	}
+	entries, err := mapData.ReadDir("maps")
+	if err != nil {
+		return fmt.Errorf("readDir: %w", err)
+	}
+	i := -1
+	for ii, elem := range entries {
+		if elem.Name() == g.mapName {
+			i = ii
+			break
+		}
+	}
+	return g.loadMap("maps/" + entries[(i+1)%len(entries)].Name())
+}
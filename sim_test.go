@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// newSimGame returns a game on an open 8x8 room, driven by the returned fake clock.
+func newSimGame(t *testing.T) (*Game, *time.Time) {
+	t.Helper()
+
+	world, err := parseMap(bigMap(8))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	now := time.Unix(0, 0)
+	g := &Game{world: world, pos: math2.Pt(2.5, 2.5), dir: math2.Pt(1, 0), plane: math2.Pt(0, 0.66)}
+	g.clock = func() time.Time { return now }
+	return g, &now
+}
+
+func TestAdvanceFrameTiming(t *testing.T) {
+	t.Parallel()
+
+	// The same input over the same time should give the same state, whatever the frame timings.
+	var results []*Game
+	for _, frames := range [][]time.Duration{
+		{16 * time.Millisecond},
+		{5 * time.Millisecond, 40 * time.Millisecond, time.Millisecond},
+		{33 * time.Millisecond, 17 * time.Millisecond},
+	} {
+		g, now := newSimGame(t)
+		if _, err := g.advance(0); err != nil {
+			t.Fatalf("advance: %s", err)
+		}
+		for i := 0; now.Sub(time.Unix(0, 0)) < time.Second; i++ {
+			*now = now.Add(frames[i%len(frames)])
+			if _, err := g.advance(actForward | actTurnLeft); err != nil {
+				t.Fatalf("advance: %s", err)
+			}
+		}
+		// Align on the same total time.
+		*now = time.Unix(1, 0)
+		if _, err := g.advance(actForward | actTurnLeft); err != nil {
+			t.Fatalf("advance: %s", err)
+		}
+		results = append(results, g)
+	}
+	for _, g := range results[1:] {
+		if g.tick != tickRate || g.pos != results[0].pos || g.dir != results[0].dir || g.plane != results[0].plane {
+			t.Errorf("unexpected state:\nexpect:\t%d %#v %#v\ngot:\t%d %#v %#v", results[0].tick, results[0].pos, results[0].dir, g.tick, g.pos, g.dir)
+		}
+	}
+	if results[0].pos == math2.Pt(2.5, 2.5) {
+		t.Error("player didn't move")
+	}
+}
+
+func TestAdvanceOneShot(t *testing.T) {
+	t.Parallel()
+
+	g, now := newSimGame(t)
+	if _, err := g.advance(0); err != nil {
+		t.Fatalf("advance: %s", err)
+	}
+
+	// No tick yet: the toggle waits for the next one.
+	if n, err := g.advance(actToggleGrid); err != nil || n != 0 || g.showMinimapGrid {
+		t.Fatalf("unexpected advance: %d %v %t", n, err, g.showMinimapGrid)
+	}
+	// Several ticks: the toggle is applied once.
+	*now = now.Add(3 * tickDuration)
+	if n, err := g.advance(actCycleMinimap); err != nil || n != 3 {
+		t.Fatalf("unexpected advance: %d %v", n, err)
+	}
+	if !g.showMinimapGrid || g.mapMod != 1 {
+		t.Errorf("unexpected toggles: grid %t, map mode %d", g.showMinimapGrid, g.mapMod)
+	}
+
+	// Long pauses are capped.
+	*now = now.Add(time.Hour)
+	if n, err := g.advance(0); err != nil || n != maxTicks {
+		t.Errorf("unexpected advance after a pause: %d %v", n, err)
+	}
+}
+
+func TestStepDeterministic(t *testing.T) {
+	t.Parallel()
+
+	inputs := []actions{actForward, actForward | actTurnRight, actStrafeLeft, actBackward | actTurnLeft, actStrafeRight, 0, actForward}
+	var states [2]math2.Point
+	for i := range states {
+		g, _ := newSimGame(t)
+		for j := 0; j < 200; j++ {
+			if err := g.step(inputs[j%len(inputs)]); err != nil {
+				t.Fatalf("step: %s", err)
+			}
+		}
+		states[i] = g.pos
+	}
+	if states[0] != states[1] {
+		t.Errorf("same inputs, different positions: %#v %#v", states[0], states[1])
+	}
+}
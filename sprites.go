@@ -0,0 +1,77 @@
+package main
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// playerTexNum is the texture of the other players.
+const playerTexNum = 7
+
+// sprite is a billboard drawn in the world, always facing the camera.
+type sprite struct {
+	pos    math2.Point
+	texNum int
+}
+
+// spriteOpaque masks the sprite texture as a disc.
+func spriteOpaque(texX, texY int) bool {
+	dx, dy := float64(texX)-texSize/2+0.5, float64(texY)-texSize/2+0.5
+	return dx*dx+dy*dy <= texSize*texSize/4
+}
+
+// drawSprites draws the sprites farthest first, hidden by the walls closer in each column.
+// The see-through walls behind each sprite are drawn before it, the ones in front are left to draw.
+//
+// Ref: https://lodev.org/cgtutor/raycasting3.html
+func (g *Game) drawSprites(img *image.RGBA, focal float64) {
+	sprites := append(g.objectSprites(), g.sprites...)
+	if len(sprites) == 0 {
+		return
+	}
+	sort.SliceStable(sprites, func(i, j int) bool {
+		return sprites[i].pos.Magnitude(g.pos) > sprites[j].pos.Magnitude(g.pos)
+	})
+
+	buffer := img.Pix
+	// Inverse of the camera matrix [planeX dirX; planeY dirY].
+	invDet := 1 / (g.plane.X*g.dir.Y - g.dir.X*g.plane.Y)
+	horizon, eye := g.horizon(), g.eyeZ()
+	for _, s := range sprites {
+		rel := s.pos.Sub(g.pos)
+		// Position in camera space, transformY being the depth.
+		transformX := invDet * (g.dir.Y*rel.X - g.dir.X*rel.Y)
+		transformY := invDet * (-g.plane.Y*rel.X + g.plane.X*rel.Y)
+		if transformY <= 0.1 {
+			continue // Behind or too close to the camera.
+		}
+
+		screenX := int(float64(g.width) / 2 * (1 + transformX/transformY))
+		size := int(math.Abs(focal / transformY))
+		if size == 0 {
+			continue
+		}
+		// Standing on the floor, as high as the walls.
+		startX := screenX - size/2
+		startY, drawStart, drawEnd := wallSpan(size, horizon, g.height, eye)
+		for x := max(0, startX); x < min(g.width, startX+size); x++ {
+			if transformY >= g.zBuffer[x] {
+				continue
+			}
+			g.drawSeeThrough(img, x, transformY, focal)
+			texX := (x - startX) * texSize / size
+			for y := drawStart; y < drawEnd; y++ {
+				texY := (y - startY) * texSize / size
+				if !spriteOpaque(texX, texY) {
+					continue
+				}
+				c := g.texturesCache[texY][s.texNum*texSize+texX]
+				off := (y*g.width + x) * 4
+				buffer[off], buffer[off+1], buffer[off+2] = c[0], c[1], c[2]
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Level object kinds counted in the stats.
+const (
+	objectTreasure = "treasure" // Picked up by walking on it.
+	objectEnemy    = "enemy"    // Killed by using it, close enough and in front.
+)
+
+// Stats settings.
+const (
+	pickupDistance = 0.5 // Distance to pick up a treasure, in cases.
+	attackDistance = 1.5 // Reach of the attack, in cases.
+	attackCos      = 0.9 // Cosine of the attack half angle, about 25 degrees.
+
+	treasureTexNum = 6
+	enemyTexNum    = playerTexNum
+)
+
+// levelStats are the player stats on a level, or summed over the campaign.
+type levelStats struct {
+	Ticks     uint64 `json:"ticks"`
+	Kills     int    `json:"kills"`
+	Secrets   int    `json:"secrets"`
+	Treasures int    `json:"treasures"`
+
+	TotalKills     int `json:"total_kills"`
+	TotalSecrets   int `json:"total_secrets"`
+	TotalTreasures int `json:"total_treasures"`
+}
+
+// add returns the sum of the stats.
+func (s levelStats) add(o levelStats) levelStats {
+	return levelStats{
+		Ticks:     s.Ticks + o.Ticks,
+		Kills:     s.Kills + o.Kills,
+		Secrets:   s.Secrets + o.Secrets,
+		Treasures: s.Treasures + o.Treasures,
+
+		TotalKills:     s.TotalKills + o.TotalKills,
+		TotalSecrets:   s.TotalSecrets + o.TotalSecrets,
+		TotalTreasures: s.TotalTreasures + o.TotalTreasures,
+	}
+}
+
+// percent returns the ratio in percent, 100 when there is nothing to find.
+func percent(n, total int) int {
+	if total == 0 {
+		return 100
+	}
+	return n * 100 / total
+}
+
+// formatTicks formats the duration as m:ss.
+func formatTicks(ticks uint64) string {
+	s := ticks / tickRate
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// resetStats resets the stats for the current level, counting what there is to find.
+func (g *Game) resetStats() {
+	g.stats = levelStats{}
+	if g.lvl == nil {
+		return
+	}
+	for _, obj := range g.lvl.objects {
+		switch obj.kind {
+		case objectTreasure:
+			g.stats.TotalTreasures++
+		case objectEnemy:
+			g.stats.TotalKills++
+		}
+	}
+	for _, t := range g.lvl.triggers {
+		for _, act := range t.actions {
+			if act.name == "secret" {
+				g.stats.TotalSecrets++
+				break
+			}
+		}
+	}
+}
+
+// removeObject removes the object from the game, which stays removed in the saves.
+// The level keeps it, so the edited level is saved as loaded.
+func (g *Game) removeObject(i int) {
+	g.objects = append(g.objects[:i], g.objects[i+1:]...)
+}
+
+// pickUp picks up the treasures under the player.
+func (g *Game) pickUp() {
+	for i := 0; i < len(g.objects); i++ {
+		obj := g.objects[i]
+		if obj.kind != objectTreasure || obj.pos.Magnitude(g.pos) > pickupDistance {
+			continue
+		}
+		g.removeObject(i)
+		i--
+		g.stats.Treasures++
+		g.startFlash(flashPickup)
+	}
+}
+
+// attack kills the closest enemy in front of the player, if in reach.
+func (g *Game) attack() {
+	target, best := -1, math.Inf(1)
+	for i, obj := range g.objects {
+		if obj.kind != objectEnemy {
+			continue
+		}
+		dist := obj.pos.Magnitude(g.pos)
+		if dist > attackDistance || dist >= best {
+			continue
+		}
+		if dist > 0 {
+			// In front: cosine of the angle between the direction and the enemy.
+			rel := obj.pos.Sub(g.pos).Scale(1 / dist)
+			if rel.X*g.dir.X+rel.Y*g.dir.Y < attackCos {
+				continue
+			}
+		}
+		target, best = i, dist
+	}
+	if target < 0 {
+		return
+	}
+	g.removeObject(target)
+	g.stats.Kills++
+	g.startShake(0.3, 0.2)
+}
+
+// objectSprites returns the sprites of the level objects counted in the stats.
+func (g *Game) objectSprites() []sprite {
+	var out []sprite
+	for _, obj := range g.objects {
+		switch obj.kind {
+		case objectTreasure:
+			out = append(out, sprite{pos: obj.pos, texNum: treasureTexNum})
+		case objectEnemy:
+			out = append(out, sprite{pos: obj.pos, texNum: enemyTexNum})
+		}
+	}
+	return out
+}
+
+func compileSecret(_ *level, args []string) (func(g *Game) error, error) {
+	if len(args) != 0 {
+		return nil, errTriggerUsage
+	}
+	return func(g *Game) error {
+		g.stats.Secrets++
+		return nil
+	}, nil
+}
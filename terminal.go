@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"time"
+)
+
+// Terminal frontend settings.
+const (
+	termFPS      = 30
+	termMoveStep = 0.2 // Distance per key press, terminals don't report key releases.
+	termTurnStep = 0.1 // Radians per key press.
+
+	// Time to wait for the rest of an escape sequence split across reads before taking it as a lone escape.
+	termEscTimeout = 50 * time.Millisecond
+)
+
+// termKey is a key read from the terminal.
+type termKey int
+
+// Terminal keys.
+const (
+	termKeyNone termKey = iota
+	termKeyUp
+	termKeyDown
+	termKeyLeft
+	termKeyRight
+	termKeyStrafeLeft
+	termKeyStrafeRight
+	termKeyQuit
+)
+
+// parseTermKeys decodes the keys from raw terminal input, including the arrow escape sequences.
+// An escape sequence cut at the end of the input is returned as is, to be prepended to the next read,
+// unless flush is set, the escape then being alone.
+func parseTermKeys(in []byte, flush bool) (keys []termKey, rest []byte) {
+	for len(in) > 0 {
+		if !flush && in[0] == 0x1b && (len(in) == 1 || len(in) == 2 && (in[1] == '[' || in[1] == 'O')) {
+			return keys, in
+		}
+		if len(in) >= 3 && in[0] == 0x1b && (in[1] == '[' || in[1] == 'O') {
+			switch in[2] {
+			case 'A':
+				keys = append(keys, termKeyUp)
+			case 'B':
+				keys = append(keys, termKeyDown)
+			case 'C':
+				keys = append(keys, termKeyRight)
+			case 'D':
+				keys = append(keys, termKeyLeft)
+			}
+			in = in[3:]
+			continue
+		}
+		switch in[0] {
+		case 'w', 'W':
+			keys = append(keys, termKeyUp)
+		case 's', 'S':
+			keys = append(keys, termKeyDown)
+		case 'a', 'A':
+			keys = append(keys, termKeyStrafeLeft)
+		case 'd', 'D':
+			keys = append(keys, termKeyStrafeRight)
+		case 'q', 'Q', 0x03, 0x1b: // Ctrl+C, lone escape.
+			keys = append(keys, termKeyQuit)
+		}
+		in = in[1:]
+	}
+	return keys, nil
+}
+
+// applyTermKey moves the player with the same moves as the graphical frontend.
+func (g *Game) applyTermKey(k termKey) {
+	switch k {
+	case termKeyUp:
+		g.moveForward(termMoveStep)
+	case termKeyDown:
+		g.moveBackwards(termMoveStep)
+	case termKeyStrafeLeft:
+		g.moveLeft(termMoveStep)
+	case termKeyStrafeRight:
+		g.moveRight(termMoveStep)
+	case termKeyLeft:
+		g.turnLeft(termTurnStep)
+	case termKeyRight:
+		g.turnRight(termTurnStep)
+	case termKeyNone, termKeyQuit:
+	}
+}
+
+// encodeANSI writes the image as cols x rows character cells using half-blocks:
+// each cell shows 2 pixels with the foreground (top) and background (bottom) 24-bit colors.
+// The image is downsampled by averaging the pixels of each half cell.
+func encodeANSI(buf *bytes.Buffer, img *image.RGBA, cols, rows int) {
+	buf.WriteString("\x1b[H") // Cursor home.
+	var lastFg, lastBg [3]byte
+	first := true
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			fg := averageColor(img, col, 2*row, cols, 2*rows)
+			bg := averageColor(img, col, 2*row+1, cols, 2*rows)
+			// Only change the colors when needed, halving the output on flat areas.
+			if first || fg != lastFg {
+				fmt.Fprintf(buf, "\x1b[38;2;%d;%d;%dm", fg[0], fg[1], fg[2])
+			}
+			if first || bg != lastBg {
+				fmt.Fprintf(buf, "\x1b[48;2;%d;%d;%dm", bg[0], bg[1], bg[2])
+			}
+			lastFg, lastBg, first = fg, bg, false
+			buf.WriteString("▀")
+		}
+		buf.WriteString("\x1b[0m\r\n")
+		first = true
+	}
+}
+
+// averageColor returns the average color of the image area matching the given cell of a w x h grid.
+func averageColor(img *image.RGBA, x, y, w, h int) [3]byte {
+	b := img.Bounds()
+	x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+max((x+1)*b.Dx()/w, x*b.Dx()/w+1)
+	y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+max((y+1)*b.Dy()/h, y*b.Dy()/h+1)
+	var sum [3]int
+	n := 0
+	for yy := y0; yy < min(y1, b.Max.Y); yy++ {
+		for xx := x0; xx < min(x1, b.Max.X); xx++ {
+			offset := img.PixOffset(xx, yy)
+			sum[0] += int(img.Pix[offset])
+			sum[1] += int(img.Pix[offset+1])
+			sum[2] += int(img.Pix[offset+2])
+			n++
+		}
+	}
+	if n == 0 {
+		return [3]byte{}
+	}
+	return [3]byte{byte(sum[0] / n), byte(sum[1] / n), byte(sum[2] / n)}
+}
+
+// cmdTerminal plays in the terminal.
+func cmdTerminal(args []string) error {
+	fs := flag.NewFlagSet("terminal", flag.ContinueOnError)
+	mapName := fs.String("map", "maps/map4", "Embedded map name or map file.")
+	scale := fs.Int("scale", 1, "Rendered pixels per half character cell. Higher values are slower but smoother.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *scale < 1 {
+		return errors.New("scale must be positive")
+	}
+
+	buf, err := mapData.ReadFile(*mapName)
+	if err != nil {
+		if buf, err = os.ReadFile(*mapName); err != nil {
+			return fmt.Errorf("readFile: %w", err)
+		}
+	}
+	lvl, err := parseLevelFile(*mapName, buf)
+	if err != nil {
+		return fmt.Errorf("parseLevelFile: %w", err)
+	}
+	g, err := newHeadlessGame(strings.TrimPrefix(*mapName, "maps/"), lvl, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	restore, err := rawTerminal()
+	if err != nil {
+		return fmt.Errorf("rawTerminal: %w", err)
+	}
+	defer restore()
+	// Hide the cursor, clear the screen, restore on exit.
+	fmt.Print("\x1b[?25l\x1b[2J")
+	defer fmt.Print("\x1b[0m\x1b[2J\x1b[H\x1b[?25h")
+
+	keys := make(chan []byte)
+	go func() {
+		defer close(keys)
+		in := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(in)
+			if err != nil {
+				return
+			}
+			keys <- append([]byte(nil), in[:n]...)
+		}
+	}()
+	resized := terminalResized()
+
+	ticker := time.NewTicker(time.Second / termFPS)
+	defer ticker.Stop()
+
+	var out bytes.Buffer
+	cols, rows, dirty := 0, 0, true
+	var pending []byte              // Escape sequence cut by the last read.
+	var escTimeout <-chan time.Time // Set while waiting for the rest of the pending sequence.
+	applyKeys := func(keys []termKey) bool {
+		for _, k := range keys {
+			if k == termKeyQuit {
+				return false
+			}
+			g.applyTermKey(k)
+			dirty = true
+		}
+		return true
+	}
+	for {
+		select {
+		case in, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			var parsed []termKey
+			parsed, pending = parseTermKeys(append(pending, in...), false)
+			escTimeout = nil
+			if len(pending) > 0 {
+				escTimeout = time.After(termEscTimeout)
+			}
+			if !applyKeys(parsed) {
+				return nil
+			}
+		case <-escTimeout:
+			parsed, _ := parseTermKeys(pending, true)
+			pending, escTimeout = nil, nil
+			if !applyKeys(parsed) {
+				return nil
+			}
+		case <-resized:
+			cols, rows = 0, 0
+		case <-ticker.C:
+			if cols == 0 {
+				if cols, rows, err = terminalSize(); err != nil {
+					return fmt.Errorf("terminalSize: %w", err)
+				}
+				rows = max(1, rows-1) // Keep a line for the status.
+				g.width, g.height = cols*(*scale), 2*rows*(*scale)
+				fmt.Print("\x1b[2J")
+				dirty = true
+			}
+			if !dirty {
+				continue
+			}
+			frame, _ := g.frame().(*image.RGBA) // Always RGBA.
+			out.Reset()
+			encodeANSI(&out, frame, cols, rows)
+			fmt.Fprintf(&out, "\x1b[0m\x1b[2K%s %s  W/S/arrows: move, A/D: strafe, Q: quit", g.mapName, g.pos)
+			if _, err := os.Stdout.Write(out.Bytes()); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+			dirty = false
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build js || windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func rawTerminal() (func(), error) {
+	return nil, errors.New("terminal frontend not supported on this platform")
+}
+
+func terminalSize() (cols, rows int, err error) {
+	return 0, 0, errors.New("terminal frontend not supported on this platform")
+}
+
+func terminalResized() <-chan os.Signal { return nil }
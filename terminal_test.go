@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+func TestParseTermKeys(t *testing.T) {
+	t.Parallel()
+
+	got, rest := parseTermKeys([]byte("w\x1b[Da\x1bOCsdx\x1b[Bq"), false)
+	expect := []termKey{termKeyUp, termKeyLeft, termKeyStrafeLeft, termKeyRight, termKeyDown, termKeyStrafeRight, termKeyDown, termKeyQuit}
+	if !reflect.DeepEqual(expect, got) || rest != nil {
+		t.Errorf("unexpected keys:\nexpect:\t%v\ngot:\t%v %q", expect, got, rest)
+	}
+
+	// Escape sequences cut by the reads are kept for the next one.
+	for _, tc := range []struct {
+		in     string
+		flush  bool
+		expect []termKey
+		rest   string
+	}{
+		{"w\x1b", false, []termKey{termKeyUp}, "\x1b"},
+		{"w\x1b[", false, []termKey{termKeyUp}, "\x1b["},
+		{"\x1bO", false, nil, "\x1bO"},
+		{"\x1bw", false, []termKey{termKeyQuit, termKeyUp}, ""},
+		{"w\x1b", true, []termKey{termKeyUp, termKeyQuit}, ""},
+		{"\x1b[", true, []termKey{termKeyQuit}, ""},
+	} {
+		got, rest := parseTermKeys([]byte(tc.in), tc.flush)
+		if !reflect.DeepEqual(tc.expect, got) || string(rest) != tc.rest {
+			t.Errorf("%q flush %t: unexpected keys:\nexpect:\t%v %q\ngot:\t%v %q", tc.in, tc.flush, tc.expect, tc.rest, got, rest)
+		}
+	}
+	// Completed by the next read.
+	if got, _ := parseTermKeys(append([]byte("\x1b["), 'A'), false); !reflect.DeepEqual([]termKey{termKeyUp}, got) {
+		t.Errorf("unexpected keys for the joined sequence: %v", got)
+	}
+}
+
+func TestApplyTermKey(t *testing.T) {
+	t.Parallel()
+
+	world, err := parseMap([]byte("1 1 1 1\n1 0 0 1\n1 1 1 1\n"))
+	if err != nil {
+		t.Fatalf("parseMap: %s", err)
+	}
+	g := &Game{world: world, pos: math2.Pt(1.5, 1.5), dir: math2.Pt(1, 0), plane: math2.Pt(0, 0.66)}
+	keys, _ := parseTermKeys([]byte("www"), false)
+	for _, k := range keys {
+		g.applyTermKey(k)
+	}
+	if expect, got := math2.Pt(2.1, 1.5), g.pos; expect.String() != got.String() {
+		t.Errorf("unexpected position:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	// The wall stops the player.
+	for i := 0; i < 10; i++ {
+		g.applyTermKey(termKeyUp)
+	}
+	if g.pos.X >= 3 {
+		t.Errorf("player went through the wall: %v", g.pos)
+	}
+}
+
+func TestEncodeANSI(t *testing.T) {
+	t.Parallel()
+
+	// 4x4 image: top half red, bottom half blue, downsampled to 2x1 cells.
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBA{R: 200, A: 255}
+			if y >= 2 {
+				c = color.RGBA{B: 100, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	encodeANSI(&buf, img, 2, 1)
+
+	expect := "\x1b[H\x1b[38;2;200;0;0m\x1b[48;2;0;0;100m▀▀\x1b[0m\r\n"
+	if got := buf.String(); expect != got {
+		t.Errorf("unexpected output:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+
+	// Averaging mixed areas: one black pixel out of 8 in the top half.
+	img.Set(0, 0, color.RGBA{A: 255})
+	buf.Reset()
+	encodeANSI(&buf, img, 1, 1)
+	if !strings.Contains(buf.String(), "\x1b[38;2;175;0;0m") {
+		t.Errorf("unexpected averaged output: %q", buf.String())
+	}
+}
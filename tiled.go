@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Tiled map editor support, JSON (.json/.tmj) and TMX (.tmx) orthogonal maps.
+//
+// The tile layer named "walls" (or the first tile layer) is the world:
+// empty tiles are empty cases and each tile is the wall type of its id in its tileset + 1.
+// The optional "floor" and "ceiling" tile layers set the textures of each case, using the tile id.
+//
+// In the object layers, the object of type/class "spawn" is the player start, with
+// an optional "angle" property in degrees. The other objects are kept as level objects
+// of their type/class with their custom properties, their name being in the "name" property.
+//
+// Ref: https://doc.mapeditor.org/en/stable/reference/json-map-format/
+// Ref: https://doc.mapeditor.org/en/stable/reference/tmx-map-format/
+
+// Tiled gid flags, flipped/rotated tiles.
+const tiledFlipMask = 0xf0000000
+
+// tiledMap is the common representation of the JSON and TMX maps.
+type tiledMap struct {
+	Orientation string `json:"orientation"`
+	Infinite    bool   `json:"infinite"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	TileWidth   int    `json:"tilewidth"`
+	TileHeight  int    `json:"tileheight"`
+
+	Tilesets []tiledTileset `json:"tilesets"`
+	Layers   []tiledLayer   `json:"layers"`
+}
+
+type tiledTileset struct {
+	FirstGID int `json:"firstgid"`
+}
+
+type tiledLayer struct {
+	Type        string          `json:"type"` // "tilelayer" or "objectgroup".
+	Name        string          `json:"name"`
+	Data        json.RawMessage `json:"data"`        // Array of gids or string.
+	Encoding    string          `json:"encoding"`    // "csv" or "base64".
+	Compression string          `json:"compression"` // "", "zlib" or "gzip".
+	Objects     []tiledObject   `json:"objects"`
+
+	gids []uint32
+}
+
+type tiledObject struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Class      string          `json:"class"`
+	GID        uint32          `json:"gid"`
+	X          float64         `json:"x"`
+	Y          float64         `json:"y"`
+	Width      float64         `json:"width"`
+	Height     float64         `json:"height"`
+	Properties []tiledProperty `json:"properties"`
+}
+
+type tiledProperty struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// parseLevelFile parses the level using the format matching the file extension.
+func parseLevelFile(name string, data []byte) (*level, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".tmj":
+		return parseTiledJSON(data)
+	case ".tmx":
+		return parseTiledTMX(data)
+	default:
+		return parseLevel(data)
+	}
+}
+
+// isTextLevel returns true if the file uses our map format.
+func isTextLevel(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".tmj", ".tmx":
+		return false
+	default:
+		return true
+	}
+}
+
+func parseTiledJSON(data []byte) (*level, error) {
+	var m tiledMap
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	for i := range m.Layers {
+		l := &m.Layers[i]
+		if l.Type != "tilelayer" {
+			continue
+		}
+		// Data is either an array of gids or an encoded string.
+		var raw string
+		if err := json.Unmarshal(l.Data, &raw); err != nil {
+			if err := json.Unmarshal(l.Data, &l.gids); err != nil {
+				return nil, fmt.Errorf("layer %q: invalid data: %w", l.Name, err)
+			}
+			continue
+		}
+		gids, err := decodeTiledData(raw, l.Encoding, l.Compression)
+		if err != nil {
+			return nil, fmt.Errorf("layer %q: %w", l.Name, err)
+		}
+		l.gids = gids
+	}
+	return m.level()
+}
+
+func parseTiledTMX(data []byte) (*level, error) {
+	type tmxProperty struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+		Text  string `xml:",chardata"` // Multiline strings.
+	}
+	type tmxObject struct {
+		ID         int           `xml:"id,attr"`
+		Name       string        `xml:"name,attr"`
+		Type       string        `xml:"type,attr"`
+		Class      string        `xml:"class,attr"`
+		GID        uint32        `xml:"gid,attr"`
+		X          float64       `xml:"x,attr"`
+		Y          float64       `xml:"y,attr"`
+		Width      float64       `xml:"width,attr"`
+		Height     float64       `xml:"height,attr"`
+		Properties []tmxProperty `xml:"properties>property"`
+	}
+	type tmxData struct {
+		Encoding    string `xml:"encoding,attr"`
+		Compression string `xml:"compression,attr"`
+		Text        string `xml:",chardata"`
+		Tiles       []struct {
+			GID uint32 `xml:"gid,attr"`
+		} `xml:"tile"`
+	}
+	// Layers and object groups are interleaved, keep them in order.
+	type tmxLayer struct {
+		XMLName xml.Name
+		Name    string      `xml:"name,attr"`
+		Data    tmxData     `xml:"data"`
+		Objects []tmxObject `xml:"object"`
+	}
+	var tmx struct {
+		Orientation string `xml:"orientation,attr"`
+		Infinite    bool   `xml:"infinite,attr"`
+		Width       int    `xml:"width,attr"`
+		Height      int    `xml:"height,attr"`
+		TileWidth   int    `xml:"tilewidth,attr"`
+		TileHeight  int    `xml:"tileheight,attr"`
+		Tilesets    []struct {
+			FirstGID int `xml:"firstgid,attr"`
+		} `xml:"tileset"`
+		Layers []tmxLayer `xml:",any"`
+	}
+	if err := xml.Unmarshal(data, &tmx); err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+
+	m := tiledMap{
+		Orientation: tmx.Orientation,
+		Infinite:    tmx.Infinite,
+		Width:       tmx.Width,
+		Height:      tmx.Height,
+		TileWidth:   tmx.TileWidth,
+		TileHeight:  tmx.TileHeight,
+	}
+	for _, ts := range tmx.Tilesets {
+		m.Tilesets = append(m.Tilesets, tiledTileset{FirstGID: ts.FirstGID})
+	}
+	for _, l := range tmx.Layers {
+		switch l.XMLName.Local {
+		case "layer":
+			layer := tiledLayer{Type: "tilelayer", Name: l.Name}
+			if l.Data.Encoding == "" {
+				// Legacy XML format, one element per tile.
+				for _, t := range l.Data.Tiles {
+					layer.gids = append(layer.gids, t.GID)
+				}
+			} else {
+				gids, err := decodeTiledData(l.Data.Text, l.Data.Encoding, l.Data.Compression)
+				if err != nil {
+					return nil, fmt.Errorf("layer %q: %w", l.Name, err)
+				}
+				layer.gids = gids
+			}
+			m.Layers = append(m.Layers, layer)
+		case "objectgroup":
+			layer := tiledLayer{Type: "objectgroup", Name: l.Name}
+			for _, o := range l.Objects {
+				obj := tiledObject{ID: o.ID, Name: o.Name, Type: o.Type, Class: o.Class, GID: o.GID, X: o.X, Y: o.Y, Width: o.Width, Height: o.Height}
+				for _, p := range o.Properties {
+					v := p.Value
+					if v == "" {
+						v = p.Text
+					}
+					obj.Properties = append(obj.Properties, tiledProperty{Name: p.Name, Value: v})
+				}
+				layer.Objects = append(layer.Objects, obj)
+			}
+			m.Layers = append(m.Layers, layer)
+		}
+	}
+	return m.level()
+}
+
+// decodeTiledData decodes the csv or base64 tile layer data.
+func decodeTiledData(data, encoding, compression string) ([]uint32, error) {
+	switch encoding {
+	case "csv":
+		var out []uint32
+		for _, elem := range strings.Split(data, ",") {
+			elem = strings.TrimSpace(elem)
+			if elem == "" {
+				continue
+			}
+			gid, err := strconv.ParseUint(elem, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gid %q: %w", elem, err)
+			}
+			out = append(out, uint32(gid))
+		}
+		return out, nil
+	case "base64":
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("base64: %w", err)
+	}
+	var r io.Reader = bytes.NewReader(buf)
+	switch compression {
+	case "":
+	case "zlib":
+		if r, err = zlib.NewReader(r); err != nil {
+			return nil, fmt.Errorf("zlib: %w", err)
+		}
+	case "gzip":
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	if buf, err = io.ReadAll(r); err != nil {
+		return nil, fmt.Errorf("decompress: %w", err)
+	}
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("invalid data length %d", len(buf))
+	}
+	out := make([]uint32, len(buf)/4)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(buf[i*4:])
+	}
+	return out, nil
+}
+
+// tileID returns the id of the tile within its tileset, -1 for empty tiles.
+func (m *tiledMap) tileID(gid uint32) int {
+	gid &^= tiledFlipMask
+	if gid == 0 {
+		return -1
+	}
+	firstGID := 1
+	for _, ts := range m.Tilesets {
+		if ts.FirstGID <= int(gid) && ts.FirstGID > firstGID {
+			firstGID = ts.FirstGID
+		}
+	}
+	return int(gid) - firstGID
+}
+
+// level converts the Tiled map to our format.
+func (m *tiledMap) level() (*level, error) {
+	if m.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("unsupported orientation %q", m.Orientation)
+	}
+	if m.Infinite {
+		return nil, errors.New("infinite maps are not supported")
+	}
+	if m.Width <= 0 || m.Height <= 0 || m.TileWidth <= 0 || m.TileHeight <= 0 {
+		return nil, fmt.Errorf("invalid map size %dx%d, tiles %dx%d", m.Width, m.Height, m.TileWidth, m.TileHeight)
+	}
+
+	var walls, floor, ceiling *tiledLayer
+	for i := range m.Layers {
+		l := &m.Layers[i]
+		if l.Type != "tilelayer" {
+			continue
+		}
+		if len(l.gids) != m.Width*m.Height {
+			return nil, fmt.Errorf("layer %q has %d tiles, expected %d", l.Name, len(l.gids), m.Width*m.Height)
+		}
+		switch strings.ToLower(l.Name) {
+		case "walls":
+			walls = l
+		case "floor":
+			floor = l
+		case "ceiling":
+			ceiling = l
+		default:
+			if walls == nil {
+				walls = l
+			}
+		}
+	}
+	if walls == nil {
+		return nil, errors.New("missing walls tile layer")
+	}
+
+	lvl := &level{
+		world: make([][]MapPoint, m.Height),
+		spawn: math2.Pt(float64(m.Width/2), float64(m.Height)/2),
+	}
+	for y := 0; y < m.Height; y++ {
+		lvl.world[y] = make([]MapPoint, m.Width)
+		for x := 0; x < m.Width; x++ {
+			i := y*m.Width + x
+			p := MapPoint{Point: math2.Pt(x, y), wallType: m.tileID(walls.gids[i]) + 1}
+			if floor != nil {
+				if id := m.tileID(floor.gids[i]); id >= 0 && id < numTextures {
+					p.floor = id + 1
+				}
+			}
+			if ceiling != nil {
+				if id := m.tileID(ceiling.gids[i]); id >= 0 && id < numTextures {
+					p.ceiling = id + 1
+				}
+			}
+			lvl.world[y][x] = p
+		}
+	}
+
+	for _, l := range m.Layers {
+		for _, o := range l.Objects {
+			if err := m.addObject(lvl, o); err != nil {
+				return nil, fmt.Errorf("layer %q: object %d %q: %w", l.Name, o.ID, o.Name, err)
+			}
+		}
+	}
+	return lvl, nil
+}
+
+// formatTiledValue formats a property value, numbers as written in the editor.
+func formatTiledValue(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func (m *tiledMap) addObject(lvl *level, o tiledObject) error {
+	kind := o.Class
+	if kind == "" {
+		kind = o.Type
+	}
+	// Tile objects are anchored on their bottom left corner.
+	if o.GID != 0 {
+		o.Y -= o.Height
+	}
+	// Center of the object, in world cases.
+	pos := math2.Pt((o.X+o.Width/2)/float64(m.TileWidth), (o.Y+o.Height/2)/float64(m.TileHeight))
+
+	props := map[string]string{}
+	for _, p := range o.Properties {
+		props[p.Name] = formatTiledValue(p.Value)
+	}
+
+	if kind == "spawn" {
+		lvl.spawn = pos
+		if v, ok := props["angle"]; ok {
+			angle, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid angle %q: %w", v, err)
+			}
+			lvl.spawnDir = math2.NewDegAngle(angle)
+		}
+		return nil
+	}
+	if kind == "" {
+		// Editor annotations, nothing for the game.
+		return nil
+	}
+	if o.Name != "" {
+		props["name"] = o.Name
+	}
+	if len(props) == 0 {
+		props = nil
+	}
+	lvl.objects = append(lvl.objects, levelObject{kind: kind, pos: pos, props: props})
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// 4x3 map, tileset starting at gid 1: gid 2 is wall type 2, gid 1 is wall type 1.
+const testTiledJSON = `{
+  "orientation": "orthogonal", "infinite": false,
+  "width": 4, "height": 3, "tilewidth": 32, "tileheight": 32,
+  "tilesets": [{"firstgid": 1, "source": "textures.tsx"}],
+  "layers": [
+    {"type": "tilelayer", "name": "walls", "width": 4, "height": 3, "data": [2, 2, 2, 2, 2, 0, 0, 1, 2, 2, 2, 2]},
+    {"type": "tilelayer", "name": "floor", "width": 4, "height": 3, "encoding": "base64", "compression": "zlib", "data": %q},
+    {"type": "objectgroup", "name": "entities", "objects": [
+      {"name": "", "type": "spawn", "x": 32, "y": 32, "width": 32, "height": 32, "properties": [{"name": "angle", "type": "float", "value": 180}]},
+      {"name": "guard1", "class": "guard", "x": 80, "y": 48, "point": true, "properties": [
+        {"name": "health", "type": "int", "value": 25},
+        {"name": "score", "type": "int", "value": 1000000},
+        {"name": "speed", "type": "float", "value": 0.25},
+        {"name": "patrol", "type": "bool", "value": true},
+        {"name": "say", "type": "string", "value": "Halt! Stop"}
+      ]},
+      {"id": 3, "name": "note", "x": 0, "y": 0}
+    ]}
+  ]
+}`
+
+const testTiledTMX = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.10" orientation="orthogonal" renderorder="right-down" width="4" height="3" tilewidth="32" tileheight="32" infinite="0">
+ <tileset firstgid="1" source="textures.tsx"/>
+ <tileset firstgid="9" source="other.tsx"/>
+ <layer id="1" name="Walls" width="4" height="3">
+  <data encoding="csv">
+2,2,2,2,
+2,0,0,10,
+2,2,2,2
+</data>
+ </layer>
+ <layer id="2" name="ceiling" width="4" height="3">
+  <data>
+   <tile gid="0"/><tile gid="0"/><tile gid="0"/><tile gid="0"/>
+   <tile gid="0"/><tile gid="4"/><tile gid="0"/><tile gid="0"/>
+   <tile gid="0"/><tile gid="0"/><tile gid="0"/><tile gid="0"/>
+  </data>
+ </layer>
+ <objectgroup id="3" name="entities">
+  <object id="1" type="spawn" x="64" y="32" width="32" height="32"/>
+  <object id="2" name="key" class="item" gid="3" x="32" y="64" width="32" height="32">
+   <properties>
+    <property name="color" value="gold"/>
+    <property name="note">multi
+line</property>
+   </properties>
+  </object>
+ </objectgroup>
+</map>`
+
+func TestParseTiledJSON(t *testing.T) {
+	t.Parallel()
+
+	// Floor layer: texture 3 under the spawn.
+	var raw bytes.Buffer
+	zw := zlib.NewWriter(&raw)
+	for _, gid := range []uint32{0, 0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0} {
+		_ = binary.Write(zw, binary.LittleEndian, gid) // Can't fail with a bytes.Buffer.
+	}
+	_ = zw.Close() // Can't fail with a bytes.Buffer.
+
+	lvl, err := parseLevelFile("test.json", []byte(strings.Replace(testTiledJSON, "%q", `"`+base64.StdEncoding.EncodeToString(raw.Bytes())+`"`, 1)))
+	if err != nil {
+		t.Fatalf("parseLevelFile: %s", err)
+	}
+
+	if expect, got := "2 2 2 2\n2 0:3 0 1\n2 2 2 2\n", string(formatLevel(lvl)); !strings.HasSuffix(got, expect) {
+		t.Errorf("unexpected world:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+	if expect, got := math2.Pt(1.5, 1.5), lvl.spawn; expect != got {
+		t.Errorf("unexpected spawn:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if expect, got := 180., lvl.spawnDir.Degrees(); expect != got {
+		t.Errorf("unexpected spawn direction:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if len(lvl.objects) != 1 {
+		t.Fatalf("unexpected objects: %+v", lvl.objects)
+	}
+	obj := lvl.objects[0]
+	if obj.kind != "guard" || obj.pos != math2.Pt(2.5, 1.5) {
+		t.Errorf("unexpected object: %+v", obj)
+	}
+	for k, v := range map[string]string{"name": "guard1", "health": "25", "score": "1000000", "speed": "0.25", "patrol": "true", "say": "Halt! Stop"} {
+		if obj.props[k] != v {
+			t.Errorf("unexpected %q property:\nexpect:\t%q\ngot:\t%q", k, v, obj.props[k])
+		}
+	}
+
+	// The properties should survive our format.
+	lvl2, err := parseLevel(formatLevel(lvl))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	if expect, got := "Halt! Stop", lvl2.objects[0].props["say"]; expect != got {
+		t.Errorf("unexpected property after round trip:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+}
+
+func TestParseTiledTMX(t *testing.T) {
+	t.Parallel()
+
+	lvl, err := parseLevelFile("test.tmx", []byte(testTiledTMX))
+	if err != nil {
+		t.Fatalf("parseLevelFile: %s", err)
+	}
+
+	// gid 10 is the second tile of the second tileset.
+	if expect, got := "2 2 2 2\n2 0::3 0 2\n2 2 2 2\n", string(formatLevel(lvl)); !strings.HasSuffix(got, expect) {
+		t.Errorf("unexpected world:\nexpect:\t%q\ngot:\t%q", expect, got)
+	}
+	if expect, got := math2.Pt(2.5, 1.5), lvl.spawn; expect != got {
+		t.Errorf("unexpected spawn:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if len(lvl.objects) != 1 {
+		t.Fatalf("unexpected objects: %+v", lvl.objects)
+	}
+	// Tile objects are anchored at the bottom.
+	if obj := lvl.objects[0]; obj.kind != "item" || obj.pos != math2.Pt(1.5, 1.5) || obj.props["color"] != "gold" || obj.props["note"] != "multi\nline" || obj.props["name"] != "key" {
+		t.Errorf("unexpected object: %+v", obj)
+	}
+}
+
+func TestParseTiledErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name, input string
+	}{
+		{"isometric", strings.Replace(testTiledTMX, "orthogonal", "isometric", 1)},
+		{"infinite", strings.Replace(testTiledTMX, `infinite="0"`, `infinite="1"`, 1)},
+		{"short layer", strings.Replace(testTiledTMX, "2,2,2,2\n</data>", "2,2,2\n</data>", 1)},
+		{"compression", strings.Replace(testTiledTMX, `<data encoding="csv">`, `<data encoding="base64" compression="zstd">`, 1)},
+	} {
+		if _, err := parseLevelFile("test.tmx", []byte(tc.input)); err == nil {
+			t.Errorf("[%s] expected an error", tc.name)
+		}
+	}
+
+	// Object errors name the object id.
+	input := strings.Replace(testTiledTMX, `<object id="1" type="spawn" x="64" y="32" width="32" height="32"/>`,
+		`<object id="1" type="spawn" x="64" y="32" width="32" height="32"><properties><property name="angle" value="north"/></properties></object>`, 1)
+	if _, err := parseLevelFile("test.tmx", []byte(input)); err == nil || !strings.Contains(err.Error(), "object 1") {
+		t.Errorf("unexpected error for an invalid spawn angle: %v", err)
+	}
+}
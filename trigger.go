@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// useDistance is how far the player reaches to use a trigger, in cases.
+const useDistance = 1.0
+
+// triggerEvent is the player event firing a trigger.
+type triggerEvent int
+
+// Trigger events.
+const (
+	triggerEnter triggerEvent = iota // The player walks into the region.
+	triggerUse                       // The player uses the region, standing in it or facing it.
+	triggerLeave                     // The player walks out of the region.
+)
+
+func (e triggerEvent) String() string {
+	return [...]string{"enter", "use", "leave"}[e]
+}
+
+// trigger is a region of the level firing actions on a player event.
+type trigger struct {
+	event   triggerEvent
+	rect    image.Rectangle // Cases covered by the region.
+	once    bool            // Only fire the first time.
+	exit    bool            // Level exit, from an @exit directive.
+	actions []triggerAction
+}
+
+// triggerAction is a parsed action of a trigger.
+type triggerAction struct {
+	name string
+	args []string            // Kept to format the level back.
+	run  func(g *Game) error // Compiled from the args when parsing the level.
+}
+
+// triggerState is the runtime state of a level trigger.
+type triggerState struct {
+	inside bool // Player in the region on the last tick.
+	done   bool // Fired once trigger.
+}
+
+// errTriggerUsage is returned by the action compilers on invalid arguments count.
+var errTriggerUsage = errors.New("invalid arguments")
+
+// triggerActionDef is an action of the trigger language.
+// compile checks the arguments against the level and returns the action to run.
+type triggerActionDef struct {
+	usage   string
+	compile func(lvl *level, args []string) (func(g *Game) error, error)
+}
+
+// triggerActions returns the registry of the trigger actions, by name.
+func triggerActions() map[string]triggerActionDef {
+	return map[string]triggerActionDef{
+		"door":     {usage: "door <x> <y>", compile: compileDoor},
+		"wall":     {usage: "wall <x> <y> <type>", compile: compileWall},
+		"teleport": {usage: "teleport <x> <y> [angle]", compile: compileTeleport},
+		"message":  {usage: "message <text...>", compile: compileMessage},
+		"end":      {usage: "end", compile: compileEnd},
+		"secret":   {usage: "secret", compile: compileSecret},
+	}
+}
+
+// parseTrigger parses the arguments of a trigger directive:
+//
+//	<enter|use|leave> <x>,<y>[,<w>,<h>] [once] <action> [args...] [; <action> [args...]]...
+func (lvl *level) parseTrigger(args []mapToken) (trigger, error) {
+	var t trigger
+	if len(args) < 3 {
+		return t, fmt.Errorf("trigger expects at least 3 arguments, got %d", len(args))
+	}
+	switch args[0].text {
+	case "enter":
+		t.event = triggerEnter
+	case "use":
+		t.event = triggerUse
+	case "leave":
+		t.event = triggerLeave
+	default:
+		return t, fmt.Errorf("unknown trigger event %q, expect enter, use or leave", args[0].text)
+	}
+	rect, err := lvl.parseRegion(args[1].text)
+	if err != nil {
+		return t, err
+	}
+	t.rect = rect
+	args = args[2:]
+	if args[0].text == "once" {
+		t.once, args = true, args[1:]
+	}
+
+	// Split the actions on ';', alone or at the end of a token.
+	var words []string
+	flush := func() error {
+		if len(words) == 0 {
+			return errors.New("empty trigger action")
+		}
+		act, err := lvl.compileAction(words[0], words[1:])
+		if err != nil {
+			return err
+		}
+		t.actions, words = append(t.actions, act), nil
+		return nil
+	}
+	for _, tok := range args {
+		text, sep := strings.CutSuffix(tok.text, ";")
+		if text != "" {
+			words = append(words, text)
+		}
+		if sep {
+			if err := flush(); err != nil {
+				return t, err
+			}
+		}
+	}
+	if len(words) > 0 || len(t.actions) == 0 {
+		if err := flush(); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// parseRegion parses "<x>,<y>" for a single case or "<x>,<y>,<w>,<h>" for a rectangle, which must be in the level.
+func (lvl *level) parseRegion(text string) (image.Rectangle, error) {
+	parts := strings.Split(text, ",")
+	if len(parts) != 2 && len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid trigger region %q, expect x,y or x,y,w,h", text)
+	}
+	vals := []int{0, 0, 1, 1}
+	for i, part := range parts {
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 || (i >= 2 && v == 0) {
+			return image.Rectangle{}, fmt.Errorf("invalid trigger region %q", text)
+		}
+		vals[i] = v
+	}
+	rect := image.Rect(vals[0], vals[1], vals[0]+vals[2], vals[1]+vals[3])
+	if !rect.In(image.Rect(0, 0, len(lvl.world[0]), len(lvl.world))) {
+		return image.Rectangle{}, fmt.Errorf("trigger region %q out of the map", text)
+	}
+	return rect, nil
+}
+
+// formatRegion is the reverse of parseRegion.
+func formatRegion(r image.Rectangle) string {
+	if r.Dx() == 1 && r.Dy() == 1 {
+		return fmt.Sprintf("%d,%d", r.Min.X, r.Min.Y)
+	}
+	return fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+}
+
+// formatTrigger formats the trigger directive arguments, the reverse of parseTrigger.
+func formatTrigger(t trigger) string {
+	if t.exit {
+		return formatRegion(t.rect)
+	}
+	out := t.event.String() + " " + formatRegion(t.rect)
+	if t.once {
+		out += " once"
+	}
+	for i, act := range t.actions {
+		if i > 0 {
+			out += " ;"
+		}
+		out += " " + strings.Join(append([]string{act.name}, act.args...), " ")
+	}
+	return out
+}
+
+// recompileTrigger checks the trigger against the level again, i.e. after a resize,
+// and compiles its actions for it.
+func (lvl *level) recompileTrigger(t trigger) (trigger, error) {
+	if _, err := lvl.parseRegion(formatRegion(t.rect)); err != nil {
+		return t, err
+	}
+	actions := make([]triggerAction, 0, len(t.actions))
+	for _, act := range t.actions {
+		act, err := lvl.compileAction(act.name, act.args)
+		if err != nil {
+			return t, err
+		}
+		actions = append(actions, act)
+	}
+	t.actions = actions
+	return t, nil
+}
+
+// parseExit parses the arguments of an exit directive, a trigger ending the level when entered:
+//
+//	<x>,<y>[,<w>,<h>]
+func (lvl *level) parseExit(args []mapToken) (trigger, error) {
+	if len(args) != 1 {
+		return trigger{}, fmt.Errorf("exit expects 1 argument, got %d", len(args))
+	}
+	rect, err := lvl.parseRegion(args[0].text)
+	if err != nil {
+		return trigger{}, err
+	}
+	end, err := lvl.compileAction("end", nil)
+	if err != nil {
+		return trigger{}, err
+	}
+	return trigger{event: triggerEnter, rect: rect, exit: true, actions: []triggerAction{end}}, nil
+}
+
+// compileAction looks up the action in the registry and compiles it.
+func (lvl *level) compileAction(name string, args []string) (triggerAction, error) {
+	def, ok := triggerActions()[name]
+	if !ok {
+		return triggerAction{}, fmt.Errorf("unknown trigger action %q", name)
+	}
+	run, err := def.compile(lvl, args)
+	if errors.Is(err, errTriggerUsage) {
+		return triggerAction{}, fmt.Errorf("usage: %s", def.usage)
+	}
+	if err != nil {
+		return triggerAction{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return triggerAction{name: name, args: args, run: run}, nil
+}
+
+// parseCase parses the case coordinates of an action, which must be in the level.
+func (lvl *level) parseCase(args []string) (image.Point, error) {
+	x, errX := strconv.Atoi(args[0])
+	y, errY := strconv.Atoi(args[1])
+	if errX != nil || errY != nil {
+		return image.Point{}, fmt.Errorf("invalid case %q %q", args[0], args[1])
+	}
+	if y < 0 || y >= len(lvl.world) || x < 0 || x >= len(lvl.world[y]) {
+		return image.Point{}, fmt.Errorf("case %d,%d out of the map", x, y)
+	}
+	return image.Pt(x, y), nil
+}
+
+func compileDoor(lvl *level, args []string) (func(g *Game) error, error) {
+	if len(args) != 2 {
+		return nil, errTriggerUsage
+	}
+	pt, err := lvl.parseCase(args)
+	if err != nil {
+		return nil, err
+	}
+	return func(g *Game) error {
+		p := g.worldCase(pt)
+		if p == nil {
+			return nil
+		}
+		if p.seeThrough() {
+			p.wallType |= wallPassable
+		} else {
+			p.wallType = 0
+		}
+		return nil
+	}, nil
+}
+
+func compileWall(lvl *level, args []string) (func(g *Game) error, error) {
+	if len(args) != 3 {
+		return nil, errTriggerUsage
+	}
+	pt, err := lvl.parseCase(args)
+	if err != nil {
+		return nil, err
+	}
+	wallType, err := strconv.ParseUint(args[2], 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wall type %q", args[2])
+	}
+	if !knownWallType(int(wallType)) {
+		return nil, fmt.Errorf("unknown wall type %#x", wallType)
+	}
+	return func(g *Game) error {
+		if p := g.worldCase(pt); p != nil {
+			p.wallType = int(wallType)
+		}
+		return nil
+	}, nil
+}
+
+func compileTeleport(lvl *level, args []string) (func(g *Game) error, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errTriggerUsage
+	}
+	var vals [3]float64
+	for i, arg := range args {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", arg)
+		}
+		vals[i] = v
+	}
+	if vals[1] < 0 || int(vals[1]) >= len(lvl.world) || vals[0] < 0 || int(vals[0]) >= len(lvl.world[int(vals[1])]) {
+		return nil, fmt.Errorf("position %g,%g out of the map", vals[0], vals[1])
+	}
+	if lvl.world[int(vals[1])][int(vals[0])].solid() {
+		return nil, fmt.Errorf("position %g,%g in a solid case", vals[0], vals[1])
+	}
+	pos, turn := math2.Pt(vals[0], vals[1]), len(args) == 3
+	angle := math2.NewDegAngle(vals[2])
+	return func(g *Game) error {
+		if p := g.worldCase(image.Pt(int(pos.X), int(pos.Y))); p == nil || p.solid() {
+			return nil
+		}
+		g.pos = pos
+		if turn {
+			g.dir = math2.Pt(1, 0).Rotate(angle)
+			g.updatePlane()
+		}
+		return nil
+	}, nil
+}
+
+func compileMessage(_ *level, args []string) (func(g *Game) error, error) {
+	if len(args) == 0 {
+		return nil, errTriggerUsage
+	}
+	msg, err := url.QueryUnescape(strings.Join(args, " "))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return func(g *Game) error {
+		g.message = msg
+		return nil
+	}, nil
+}
+
+func compileEnd(_ *level, args []string) (func(g *Game) error, error) {
+	if len(args) != 0 {
+		return nil, errTriggerUsage
+	}
+	return (*Game).endLevel, nil
+}
+
+// worldCase returns the case of the current world, nil when out of it,
+// i.e. when the editor shrank the world after the level was parsed.
+func (g *Game) worldCase(pt image.Point) *MapPoint {
+	if pt.Y < 0 || pt.Y >= len(g.world) || pt.X < 0 || pt.X >= len(g.world[pt.Y]) {
+		return nil
+	}
+	return &g.world[pt.Y][pt.X]
+}
+
+// resetTriggers resets the triggers state for the current level.
+// The triggers the player starts in don't fire until left and entered again.
+func (g *Game) resetTriggers() {
+	g.triggers = nil
+	if g.lvl == nil {
+		return
+	}
+	g.triggers = make([]triggerState, len(g.lvl.triggers))
+	cell := image.Pt(int(g.pos.X), int(g.pos.Y))
+	for i, t := range g.lvl.triggers {
+		g.triggers[i].inside = cell.In(t.rect)
+	}
+}
+
+// firedTriggers returns the done state of the triggers, nil when none fired.
+func (g *Game) firedTriggers() []bool {
+	var out []bool
+	for i, st := range g.triggers {
+		if st.done {
+			if out == nil {
+				out = make([]bool, len(g.triggers))
+			}
+			out[i] = true
+		}
+	}
+	return out
+}
+
+// runTriggers fires the level triggers from the player position, use being set when the player uses what's in front.
+func (g *Game) runTriggers(use bool) error {
+	lvl := g.lvl
+	if lvl == nil || len(g.triggers) != len(lvl.triggers) {
+		return nil
+	}
+	cell := image.Pt(int(g.pos.X), int(g.pos.Y))
+	front := image.Pt(int(g.pos.X+g.dir.X*useDistance), int(g.pos.Y+g.dir.Y*useDistance))
+	for i, t := range lvl.triggers {
+		st := &g.triggers[i]
+		inside := cell.In(t.rect)
+		var fire bool
+		switch t.event {
+		case triggerEnter:
+			fire = inside && !st.inside
+		case triggerLeave:
+			fire = !inside && st.inside
+		case triggerUse:
+			fire = use && (inside || front.In(t.rect))
+		}
+		st.inside = inside
+		if !fire || st.done {
+			continue
+		}
+		st.done = t.once
+		for _, act := range t.actions {
+			if err := act.run(g); err != nil {
+				return fmt.Errorf("trigger %q: %w", formatTrigger(t), err)
+			}
+			if g.lvl != lvl {
+				// The level changed, the remaining triggers are gone.
+				return nil
+			}
+		}
+	}
+	return nil
+}
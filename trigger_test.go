@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// newTriggerGame returns a game on the given level, facing east.
+func newTriggerGame(t *testing.T, mapData string) *Game {
+	t.Helper()
+
+	lvl, err := parseLevel([]byte(mapData))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	g := &Game{}
+	g.setLevel("test", lvl)
+	return g
+}
+
+// walk steps the game with the given actions for the given number of ticks.
+func walk(t *testing.T, g *Game, a actions, ticks int) {
+	t.Helper()
+
+	for i := 0; i < ticks; i++ {
+		if err := g.step(a); err != nil {
+			t.Fatalf("step: %s", err)
+		}
+	}
+}
+
+const triggerCorridor = `1 1 1 1 1 1 1 1
+1 0 0 0 0 0 12 1
+1 1 1 1 1 1 1 1
+`
+
+func TestTriggerEnterLeave(t *testing.T) {
+	t.Parallel()
+
+	g := newTriggerGame(t, "@spawn 1.5 1.5\n"+
+		"@trigger enter 3,1 message in\n"+
+		"@trigger leave 3,1,1,1 message out\n"+
+		"@trigger enter 1,1 message spawn\n"+
+		triggerCorridor)
+
+	// Not fired by the spawn.
+	walk(t, g, 0, 1)
+	if g.message != "" {
+		t.Fatalf("unexpected message %q", g.message)
+	}
+	// 3.5 cases per second, entering the case 3 after about 0.43s.
+	walk(t, g, actForward, tickRate/4)
+	if g.message != "" {
+		t.Fatalf("unexpected message %q before the region", g.message)
+	}
+	walk(t, g, actForward, tickRate/4)
+	if expect, got := "in", g.message; expect != got {
+		t.Fatalf("unexpected message after entering, expect %q, got %q", expect, got)
+	}
+	// Entering only fires once per visit.
+	g.message = ""
+	walk(t, g, actForward, 2)
+	if g.message != "" {
+		t.Fatalf("unexpected message %q while inside", g.message)
+	}
+	walk(t, g, actForward, tickRate/4)
+	if expect, got := "out", g.message; expect != got {
+		t.Fatalf("unexpected message after leaving, expect %q, got %q", expect, got)
+	}
+	// Back to the spawn, entered again.
+	walk(t, g, actBackward, tickRate)
+	if expect, got := "spawn", g.message; expect != got {
+		t.Fatalf("unexpected message back at the spawn, expect %q, got %q", expect, got)
+	}
+}
+
+func TestTriggerUseDoor(t *testing.T) {
+	t.Parallel()
+
+	g := newTriggerGame(t, "@spawn 5.5 1.5\n"+
+		"@trigger use 6,1 once door 6 1 ; message Door%20open\n"+
+		triggerCorridor)
+
+	// The window blocks the way.
+	walk(t, g, actForward, tickRate)
+	if g.pos.X >= 6 {
+		t.Fatalf("walked through the closed door: %v", g.pos)
+	}
+	walk(t, g, actUse, 1)
+	if expect, got := "Door open", g.message; expect != got {
+		t.Fatalf("unexpected message, expect %q, got %q", expect, got)
+	}
+	if expect, got := wallWindow|wallPassable, g.world[1][6].wallType; expect != got {
+		t.Fatalf("unexpected wall type, expect %#x, got %#x", expect, got)
+	}
+	walk(t, g, actForward, tickRate/2)
+	if g.pos.X < 6 {
+		t.Fatalf("didn't walk through the open door: %v", g.pos)
+	}
+
+	// Once.
+	g.message = ""
+	walk(t, g, actUse, 1)
+	if g.message != "" {
+		t.Fatalf("once trigger fired again: %q", g.message)
+	}
+}
+
+func TestTriggerTeleportWall(t *testing.T) {
+	t.Parallel()
+
+	g := newTriggerGame(t, "@spawn 1.5 1.5\n"+
+		"@trigger enter 2,1 teleport 4.5 1.5 180; wall 3 1 2\n"+
+		triggerCorridor)
+
+	walk(t, g, actForward, tickRate/4)
+	// Teleported, then walked west to the new wall.
+	if g.pos.X < 4 || g.pos.X >= 4.5 || g.pos.Y != 1.5 {
+		t.Fatalf("unexpected position %v", g.pos)
+	}
+	if g.dir.X > -0.99 {
+		t.Fatalf("unexpected direction %v, expect west", g.dir)
+	}
+	if expect, got := 2, g.world[1][3].wallType; expect != got {
+		t.Fatalf("unexpected wall type, expect %d, got %d", expect, got)
+	}
+	// The new wall blocks the way back.
+	walk(t, g, actForward, tickRate)
+	if g.pos.X < 4 {
+		t.Fatalf("walked through the new wall: %v", g.pos)
+	}
+}
+
+func TestTriggerOutOfWorld(t *testing.T) {
+	t.Parallel()
+
+	g := newTriggerGame(t, "@spawn 1.5 1.5\n"+
+		"@trigger use 1,1 door 6 1 ; wall 5 1 2 ; teleport 5.5 1.5\n"+
+		triggerCorridor)
+
+	// The world shrank after the level was parsed, the actions on the gone cases do nothing.
+	g.world = [][]MapPoint{g.world[0][:4], g.world[1][:4], g.world[2][:4]}
+	walk(t, g, actUse, 1)
+	if g.pos.X != 1.5 || g.pos.Y != 1.5 {
+		t.Fatalf("teleported out of the world: %v", g.pos)
+	}
+}
+
+func TestTriggerEnd(t *testing.T) {
+	t.Parallel()
+
+	g := newTriggerGame(t, "@spawn 1.5 1.5\n@trigger enter 2,1 end ; message unreachable\n"+triggerCorridor)
+	g.mapName = "map1"
+	walk(t, g, actForward, tickRate/4)
+	if expect, got := "map2", g.mapName; expect != got {
+		t.Fatalf("unexpected map, expect %q, got %q", expect, got)
+	}
+	if g.message != "" {
+		t.Fatalf("action run after the level end: %q", g.message)
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		directive, err string
+	}{
+		{"@trigger enter 1,1", "at least 3 arguments"},
+		{"@trigger jump 1,1 end", "unknown trigger event"},
+		{"@trigger enter 1,1,0,1 end", "invalid trigger region"},
+		{"@trigger enter 1 end", "invalid trigger region"},
+		{"@trigger enter 1,1 once", "empty trigger action"},
+		{"@trigger enter 1,1 end ; ; end", "empty trigger action"},
+		{"@trigger enter 1,1 explode", "unknown trigger action"},
+		{"@trigger enter 1,1 door 1", "usage: door <x> <y>"},
+		{"@trigger enter 1,1 door 9 1", "out of the map"},
+		{"@trigger enter 1,1 wall 1 1 z", "invalid wall type"},
+		{"@trigger enter 1,1 wall 1 1 13", "unknown wall type 0x13"},
+		{"@trigger enter 1,1 teleport 1 -1", "out of the map"},
+		{"@trigger enter 1,1 teleport 0.5 1.5", "in a solid case"},
+		{"@trigger enter 7,2,2,1 end", "out of the map"},
+		{"@exit 8,1", "out of the map"},
+		{"@trigger enter 1,1 message %zz", "invalid message"},
+	} {
+		if _, err := parseLevel([]byte(tc.directive + "\n" + triggerCorridor)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: unexpected error, expect %q, got %v", tc.directive, tc.err, err)
+		}
+	}
+
+	// Round trip.
+	const directives = "@trigger enter 1,1 once door 6 1 ; message a%20b\n@trigger leave 1,1,3,1 teleport 2.5 1.5 ; wall 3 1 12 ; end\n"
+	lvl, err := parseLevel([]byte("@spawn 1.5 1.5 0\n" + directives + triggerCorridor))
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	if out := string(formatLevel(lvl)); !strings.Contains(out, directives) {
+		t.Errorf("unexpected format, expect %q in:\n%s", directives, out)
+	}
+}
+
+func TestTriggerSaveState(t *testing.T) {
+	t.Parallel()
+
+	const mapData = "@spawn 1.5 1.5\n@trigger enter 2,1 once message first\n@trigger enter 3,1 message second\n" + triggerCorridor
+	g := newTriggerGame(t, mapData)
+	walk(t, g, actForward, tickRate/4)
+	if expect, got := "first", g.message; expect != got {
+		t.Fatalf("unexpected message, expect %q, got %q", expect, got)
+	}
+	buf, err := g.marshalState()
+	if err != nil {
+		t.Fatalf("marshalState: %s", err)
+	}
+
+	g2 := newTriggerGame(t, mapData)
+	if err := g2.unmarshalState(buf); err != nil {
+		t.Fatalf("unmarshalState: %s", err)
+	}
+	walk(t, g2, actBackward, tickRate/2)
+	walk(t, g2, actForward, tickRate/3)
+	if g2.message != "" {
+		t.Fatalf("once trigger fired again after loading: %q", g2.message)
+	}
+}
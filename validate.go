@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// mapIssue is a problem found in a map file.
+type mapIssue struct {
+	line, col int // 1-based position in the file, 0 when not applicable.
+	msg       string
+	warning   bool // Suspicious but playable, doesn't fail the validation.
+}
+
+func (i mapIssue) String() string {
+	if i.warning {
+		return fmt.Sprintf("%d:%d: warning: %s", i.line, i.col, i.msg)
+	}
+	return fmt.Sprintf("%d:%d: %s", i.line, i.col, i.msg)
+}
+
+// knownWallType returns true if the wall type has a texture.
+// The opaque walls past the last texture are drawn with it.
+func knownWallType(wallType int) bool {
+	if wallType < wallBars {
+		return true
+	}
+	switch wallType &^ wallPassable {
+	case wallBars, wallFence, wallWindow:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateMap checks the map file and returns all the problems found:
+//   - invalid or unknown wall types and textures,
+//   - non-rectangular rows,
+//   - open perimeter, letting the rays escape the world,
+//   - invalid directives,
+//   - spawn point out of the map or in a solid case,
+//   - areas not reachable from the spawn point, as warnings.
+func validateMap(mapData []byte) []mapIssue {
+	grid := tokenizeMap(mapData)
+	if len(grid) == 0 {
+		return []mapIssue{{msg: "no points"}}
+	}
+
+	var issues []mapIssue
+	issuef := func(tok mapToken, format string, args ...any) {
+		issues = append(issues, mapIssue{line: tok.line, col: tok.col, msg: fmt.Sprintf(format, args...)})
+	}
+
+	// Parse the values, keeping invalid ones as empty cases to check the rest.
+	world := make([][]MapPoint, len(grid))
+	for y, line := range grid {
+		world[y] = make([]MapPoint, len(line))
+		for x, tok := range line {
+			p, err := parseCell(tok.text)
+			if err != nil {
+				issuef(tok, "%s", err)
+				continue
+			}
+			if !knownWallType(p.wallType) {
+				issuef(tok, "unknown wall type %#x", p.wallType)
+			}
+			world[y][x] = p
+		}
+		if len(line) != len(grid[0]) {
+			issuef(line[0], "row has %d cases, expected %d", len(line), len(grid[0]))
+		}
+	}
+
+	// The perimeter must be made of opaque walls, otherwise the rays go out of the world.
+	closed := func(p MapPoint) bool { return p.wallType != 0 && !p.seeThrough() }
+	for y, line := range grid {
+		for x, tok := range line {
+			if y != 0 && y != len(grid)-1 && x != 0 && x != len(line)-1 {
+				continue
+			}
+			if !closed(world[y][x]) {
+				issuef(tok, "open perimeter")
+			}
+		}
+	}
+
+	// Check the directives and get the spawn point.
+	lvl := &level{world: world, spawn: math2.Pt(float64(len(world[0])/2), float64(len(world))/2)}
+	for _, d := range parseDirectives(mapData) {
+		if err := lvl.applyDirective(d); err != nil {
+			issuef(d[0], "%s", err)
+		}
+	}
+	spawn := image.Pt(int(lvl.spawn.X), int(lvl.spawn.Y))
+	if lvl.spawn.X < 0 || lvl.spawn.Y < 0 || spawn.Y >= len(world) || spawn.X >= len(world[spawn.Y]) {
+		issues = append(issues, mapIssue{msg: fmt.Sprintf("spawn point %d/%d is out of the map", spawn.X, spawn.Y)})
+		return issues
+	}
+	if world[spawn.Y][spawn.X].solid() {
+		issuef(grid[spawn.Y][spawn.X], "spawn point %d/%d is in a solid case", spawn.X, spawn.Y)
+		return issues
+	}
+
+	// Flood fill from the spawn point and report each unreachable area once.
+	reachable := floodFill(world, spawn)
+	for y, line := range world {
+		for x, p := range line {
+			if p.solid() || reachable[image.Pt(x, y)] {
+				continue
+			}
+			area := floodFill(world, image.Pt(x, y))
+			for pt := range area {
+				reachable[pt] = true
+			}
+			tok := grid[y][x]
+			issues = append(issues, mapIssue{line: tok.line, col: tok.col, msg: fmt.Sprintf("unreachable area of %d cases", len(area)), warning: true})
+		}
+	}
+
+	return issues
+}
+
+// floodFill returns the non-solid cases connected to the starting point.
+func floodFill(world [][]MapPoint, start image.Point) map[image.Point]bool {
+	seen := map[image.Point]bool{start: true}
+	queue := []image.Point{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range []image.Point{cur.Add(image.Pt(1, 0)), cur.Add(image.Pt(-1, 0)), cur.Add(image.Pt(0, 1)), cur.Add(image.Pt(0, -1))} {
+			if next.Y < 0 || next.Y >= len(world) || next.X < 0 || next.X >= len(world[next.Y]) {
+				continue
+			}
+			if seen[next] || world[next.Y][next.X].solid() {
+				continue
+			}
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return seen
+}
+
+// cmdValidate validates the given map files, or the embedded maps if none is given.
+func cmdValidate(args []string) error {
+	names, readFile := args, os.ReadFile
+	if len(names) == 0 {
+		entries, err := mapData.ReadDir("maps")
+		if err != nil {
+			return fmt.Errorf("readDir: %w", err)
+		}
+		for _, elem := range entries {
+			names = append(names, "maps/"+elem.Name())
+		}
+		readFile = mapData.ReadFile
+	}
+
+	failed := 0
+	for _, name := range names {
+		buf, err := readFile(name)
+		if err != nil {
+			return fmt.Errorf("readFile %q: %w", name, err)
+		}
+		// Other formats are checked once converted, the positions referring to the converted map.
+		if !isTextLevel(name) {
+			lvl, err := parseLevelFile(name, buf)
+			if err != nil {
+				fmt.Printf("%s: %s\n", name, err)
+				failed++
+				continue
+			}
+			buf = formatLevel(lvl)
+		}
+		invalid := false
+		for _, issue := range validateMap(buf) {
+			fmt.Printf("%s:%s\n", name, issue)
+			invalid = invalid || !issue.warning
+		}
+		if invalid {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d invalid maps", failed, len(names))
+	}
+	return nil
+}
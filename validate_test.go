@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateEmbeddedMaps(t *testing.T) {
+	t.Parallel()
+
+	entries, err := mapData.ReadDir("maps")
+	if err != nil {
+		t.Fatalf("readDir: %s", err)
+	}
+	for _, elem := range entries {
+		buf, err := mapData.ReadFile("maps/" + elem.Name())
+		if err != nil {
+			t.Fatalf("readFile: %s", err)
+		}
+		for _, issue := range validateMap(buf) {
+			if !issue.warning {
+				t.Errorf("%s:%s", elem.Name(), issue)
+			}
+		}
+	}
+}
+
+func TestValidateMap(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{
+			name:  "valid",
+			input: "1 1 1\n1 0 1\n1 1 1\n",
+		},
+		{
+			name:   "empty",
+			input:  "# Nothing.\n",
+			expect: []string{"0:0: no points"},
+		},
+		{
+			name:   "invalid and unknown",
+			input:  "1 1 1 1\n1 0 zz 1\n1 13 0 1\n1 0 ff 1\n1 1 1 1\n",
+			expect: []string{`2:5: invalid wall type "zz"`, "3:3: unknown wall type 0x13", "4:5: unknown wall type 0xff"},
+		},
+		{
+			name:  "last texture",
+			input: "8 8 8 8 8\n8 0 0 0 b\n8 0 0 0 f\nA 8 8 8 8\n",
+		},
+		{
+			name:   "textures",
+			input:  "1 1 1 1\n1 0:3:2 0:9 1\n1 0::x 0:: 1\n1 1 1 1\n",
+			expect: []string{`2:9: invalid floor texture "9"`, `3:3: invalid ceiling texture "x"`},
+		},
+		{
+			name:   "ragged",
+			input:  "1 1 1\n1 0 1 1\n1 1 1\n",
+			expect: []string{"2:1: row has 4 cases, expected 3"},
+		},
+		{
+			name:   "open perimeter",
+			input:  "1 1 1\n0 0 1\n1 10 1\n",
+			expect: []string{"2:1: open perimeter", "3:3: open perimeter"},
+		},
+		{
+			name:   "solid spawn",
+			input:  "1 1 1\n1 2 1\n1 1 1\n",
+			expect: []string{"2:3: spawn point 1/1 is in a solid case"},
+		},
+		{
+			name:   "spawn out of the map",
+			input:  "1 1 1\n1 0 1\n1 1 1\n@spawn 4 1\n",
+			expect: []string{"0:0: spawn point 4/1 is out of the map"},
+		},
+		{
+			name:   "invalid directives",
+			input:  "1 1 1\n1 0 1\n1 1 1\n@spawn 1.5\n@foo 1\n@spawn a b\n",
+			expect: []string{"4:2: spawn expects 2 or 3 arguments, got 1", `5:2: unknown directive "foo"`, `6:2: invalid spawn argument "a": strconv.ParseFloat: parsing "a": invalid syntax`},
+		},
+		{
+			name:   "unreachable",
+			input:  "# Comment.\n1 1 1 1 1\n1 0 1 0 1\n1 0 1 0 1\n\n1 1 1 1 1\n@spawn 1.5 1.5\n",
+			expect: []string{"3:7: warning: unreachable area of 2 cases"},
+		},
+	} {
+		issues := validateMap([]byte(tc.input))
+		if len(issues) != len(tc.expect) {
+			t.Errorf("[%s] unexpected issues:\nexpect:\t%q\ngot:\t%v", tc.name, tc.expect, issues)
+			continue
+		}
+		for i, issue := range issues {
+			if expect, got := tc.expect[i], issue.String(); expect != got {
+				t.Errorf("[%s] unexpected issue:\nexpect:\t%s\ngot:\t%s", tc.name, expect, got)
+			}
+		}
+	}
+}
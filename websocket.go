@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // Required by the WebSocket handshake, not used for security.
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Minimal WebSocket (RFC 6455) implementation, enough for our JSON messages.
+//
+// Ref: https://datatracker.ietf.org/doc/html/rfc6455
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsCloseProtocolError = 1002
+)
+
+// errWSProtocol is returned on frames breaking the protocol, closing the connection with wsCloseProtocolError.
+var errWSProtocol = errors.New("websocket protocol error")
+
+// wsConn is a WebSocket connection, sending each message as a text frame.
+type wsConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	client bool // Clients mask their frames.
+
+	mu sync.Mutex // Serializes the writes.
+}
+
+// wsAccept returns the Sec-WebSocket-Accept value for the given key.
+func wsAccept(key string) string {
+	h := sha1.New()                      //nolint:gosec // Required by the protocol.
+	_, _ = io.WriteString(h, key+wsGUID) // Can't fail.
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// acceptWebSocket upgrades the HTTP request to a WebSocket connection.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || r.Header.Get("Sec-WebSocket-Key") == "" {
+		http.Error(w, "websocket expected", http.StatusBadRequest)
+		return nil, errors.New("not a websocket request")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijack not supported", http.StatusInternalServerError)
+		return nil, errors.New("hijack not supported")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("hijack: %w", err)
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		_ = conn.Close() // Best effort.
+		return nil, fmt.Errorf("write handshake: %w", err)
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// websocketHandshake opens the WebSocket on the given connection to the server.
+func websocketHandshake(conn net.Conn, u *url.URL) (*wsConn, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("rand: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1,
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("write handshake: %w", err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, fmt.Errorf("read handshake: %w", err)
+	}
+	_ = resp.Body.Close() // No body on 101.
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("unexpected handshake status %q", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return nil, errors.New("invalid handshake accept key")
+	}
+	return &wsConn{conn: conn, r: r, client: true}, nil
+}
+
+func (c *wsConn) send(msg *netMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	return c.writeFrame(wsOpText, data)
+}
+
+// writeFrame writes a whole message in a single frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|opcode) // Final fragment.
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return fmt.Errorf("rand: %w", err)
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		for i := range buf[start:] {
+			buf[start+i] ^= mask[i%4]
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.conn.Write(buf); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// readFrame reads the next frame, unmasking the payload.
+// The mask is required from the clients and refused from the server.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return false, 0, nil, fmt.Errorf("read header: %w", err)
+	}
+	fin, opcode = hdr[0]&0x80 != 0, hdr[0]&0x0f
+	masked := hdr[1]&0x80 != 0
+	// Clients must mask their frames, servers must not (section 5.1).
+	if masked == c.client {
+		return false, 0, nil, fmt.Errorf("%w: unexpected mask bit %t", errWSProtocol, masked)
+	}
+
+	size := uint64(hdr[1] & 0x7f)
+	switch size {
+	case 126:
+		var n uint16
+		if err := binary.Read(c.r, binary.BigEndian, &n); err != nil {
+			return false, 0, nil, fmt.Errorf("read size: %w", err)
+		}
+		size = uint64(n)
+	case 127:
+		if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+			return false, 0, nil, fmt.Errorf("read size: %w", err)
+		}
+	}
+	if size > netMaxMessage {
+		return false, 0, nil, fmt.Errorf("frame too big: %d", size)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("read mask: %w", err)
+		}
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, fmt.Errorf("read payload: %w", err)
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+func (c *wsConn) recv() (*netMessage, error) {
+	var data []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			if errors.Is(err, errWSProtocol) {
+				_ = c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseProtocolError)) // Best effort.
+			}
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			_ = c.writeFrame(wsOpClose, nil) // Best effort.
+			return nil, io.EOF
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			data = append(data, payload...)
+		default:
+			return nil, fmt.Errorf("unknown opcode %#x", opcode)
+		}
+		if len(data) > netMaxMessage {
+			return nil, fmt.Errorf("message too big: %d", len(data))
+		}
+		if fin {
+			break
+		}
+	}
+	msg := &netMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return msg, nil
+}
+
+func (c *wsConn) Close() error { return c.conn.Close() }
+
+// isWebSocketURL returns true for ws:// and wss:// addresses.
+func isWebSocketURL(addr string) bool {
+	return strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://")
+}
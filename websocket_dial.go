@@ -0,0 +1,45 @@
+//go:build !js
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// dialWebSocket connects to the ws:// or wss:// server.
+func dialWebSocket(rawURL string) (netConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		conn, err = tls.Dial("tcp", host, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	c, err := websocketHandshake(conn, u)
+	if err != nil {
+		_ = conn.Close() // Best effort.
+		return nil, err
+	}
+	return c, nil
+}
+
+// browserJoinArgs returns the join command arguments from the page URL, only in the browser.
+func browserJoinArgs() []string { return nil }
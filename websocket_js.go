@@ -0,0 +1,145 @@
+//go:build js
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall/js"
+)
+
+// jsWebSocket is a connection using the browser WebSocket API, raw sockets being unavailable.
+type jsWebSocket struct {
+	ws        js.Value
+	msgs      chan []byte
+	listeners []jsListener
+
+	mu     sync.Mutex
+	err    error
+	closed bool // msgs closed.
+}
+
+// jsListener is an event listener of the WebSocket, released on Close.
+type jsListener struct {
+	event string
+	fn    js.Func
+}
+
+// dialWebSocket connects to the ws:// or wss:// server.
+func dialWebSocket(rawURL string) (netConn, error) {
+	c := &jsWebSocket{
+		ws:   js.Global().Get("WebSocket").New(rawURL),
+		msgs: make(chan []byte, 64),
+	}
+	opened := make(chan error, 1)
+	on := func(event string, fn func(ev js.Value)) {
+		f := js.FuncOf(func(_ js.Value, args []js.Value) any {
+			fn(args[0])
+			return nil
+		})
+		c.listeners = append(c.listeners, jsListener{event: event, fn: f})
+		c.ws.Call("addEventListener", event, f)
+	}
+	on("open", func(js.Value) { opened <- nil })
+	on("message", func(ev js.Value) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			return
+		}
+		// Called from the event loop, must not block.
+		select {
+		case c.msgs <- []byte(ev.Get("data").String()):
+		default:
+		}
+	})
+	on("error", func(js.Value) {
+		select {
+		case opened <- errors.New("websocket error"):
+		default:
+		}
+	})
+	on("close", func(ev js.Value) {
+		c.closeMsgs(fmt.Errorf("websocket closed: %d", ev.Get("code").Int()))
+	})
+	if err := <-opened; err != nil {
+		_ = c.Close() // Best effort.
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *jsWebSocket) send(msg *netMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.ws.Call("send", string(data))
+	return nil
+}
+
+func (c *jsWebSocket) recv() (*netMessage, error) {
+	data, ok := <-c.msgs
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err == nil {
+			return nil, io.EOF
+		}
+		return nil, c.err
+	}
+	msg := &netMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return msg, nil
+}
+
+// closeMsgs ends the received messages with the given error, once.
+func (c *jsWebSocket) closeMsgs(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	if !c.closed {
+		c.closed = true
+		close(c.msgs)
+	}
+}
+
+// Close closes the connection and releases the event listeners,
+// which are removed first so the browser doesn't call them once released.
+func (c *jsWebSocket) Close() error {
+	c.ws.Call("close")
+	c.closeMsgs(net.ErrClosed)
+	for _, l := range c.listeners {
+		c.ws.Call("removeEventListener", l.event, l.fn)
+		l.fn.Release()
+	}
+	c.listeners = nil
+	return nil
+}
+
+// browserJoinArgs returns the join command arguments from the page URL,
+// i.e. ?join=ws://host:8080/ws&name=bob.
+func browserJoinArgs() []string {
+	params := js.Global().Get("URLSearchParams").New(js.Global().Get("location").Get("search"))
+	if addr := params.Call("get", "join"); addr.Type() == js.TypeString {
+		name := params.Call("get", "name")
+		if name.Type() != js.TypeString {
+			return []string{addr.String()}
+		}
+		return []string{"-name", name.String(), addr.String()}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// dialTestWebSocket connects to the server over WebSocket, using the native handshake (also in wasm tests).
+func dialTestWebSocket(t *testing.T, addr, name string) *netClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %s", err)
+	}
+	wc, err := websocketHandshake(conn, &url.URL{Scheme: "ws", Host: addr, Path: "/ws"})
+	if err != nil {
+		t.Fatalf("websocketHandshake: %s", err)
+	}
+	c, err := dialClient(wc, name)
+	if err != nil {
+		t.Fatalf("dialClient: %s", err)
+	}
+	t.Cleanup(func() { _ = c.conn.Close() })
+	return c
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	t.Parallel()
+
+	// Example from the RFC.
+	if expect, got := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", wsAccept("dGhlIHNhbXBsZSBub25jZQ=="); expect != got {
+		t.Fatalf("unexpected accept key:\nexpect:\t%s\ngot:\t%s", expect, got)
+	}
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	t.Parallel()
+
+	a, b := net.Pipe()
+	client, server := &wsConn{conn: a, r: bufio.NewReader(a), client: true}, &wsConn{conn: b, r: bufio.NewReader(b)}
+	t.Cleanup(func() { _, _ = client.Close(), server.Close() })
+
+	// The 3 length encodings, both ways.
+	for _, size := range []int{10, 1000, 100000} {
+		msg := &netMessage{Type: netMsgWelcome, Level: strings.Repeat("0", size)}
+		for _, dir := range [][2]*wsConn{{client, server}, {server, client}} {
+			errCh := make(chan error, 1)
+			go func(c *wsConn) { errCh <- c.send(msg) }(dir[0])
+			got, err := dir[1].recv()
+			if err != nil {
+				t.Fatalf("recv %d: %s", size, err)
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("send %d: %s", size, err)
+			}
+			if got.Type != msg.Type || got.Level != msg.Level {
+				t.Fatalf("unexpected message of size %d", size)
+			}
+		}
+	}
+
+	// Pings are answered, then the message is received.
+	go func() {
+		_ = client.writeFrame(wsOpPing, []byte("hi"))
+		_ = client.send(&netMessage{Type: netMsgInput, Actions: actForward})
+	}()
+	pong := make(chan string, 1)
+	go func() {
+		_, opcode, payload, err := client.readFrame()
+		if err != nil || opcode != wsOpPong {
+			pong <- ""
+			return
+		}
+		pong <- string(payload)
+	}()
+	msg, err := server.recv()
+	if err != nil {
+		t.Fatalf("recv: %s", err)
+	}
+	if msg.Actions != actForward {
+		t.Errorf("unexpected message after ping: %+v", msg)
+	}
+	if got := <-pong; got != "hi" {
+		t.Errorf("unexpected pong: %q", got)
+	}
+}
+
+func TestWebSocketUnmasked(t *testing.T) {
+	t.Parallel()
+
+	a, b := net.Pipe()
+	server := &wsConn{conn: b, r: bufio.NewReader(b)}
+	t.Cleanup(func() { _, _ = a.Close(), server.Close() })
+
+	// An unmasked text frame from the client.
+	go func() { _, _ = a.Write([]byte{0x80 | wsOpText, 2, '{', '}'}) }()
+	closed := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 4)
+		_, _ = io.ReadFull(a, buf)
+		closed <- buf
+	}()
+	if _, err := server.recv(); !errors.Is(err, errWSProtocol) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expect, got := []byte{0x80 | wsOpClose, 2, 0x03, 0xea}, <-closed; !bytes.Equal(expect, got) {
+		t.Errorf("unexpected close frame:\nexpect:\t%x\ngot:\t%x", expect, got)
+	}
+}
+
+func TestWebSocketMultiplayer(t *testing.T) {
+	t.Parallel()
+
+	s, addr := startTestServer(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err)
+	}
+	go func() { _ = s.serveWebSocket(l) }() // Stopped by Close.
+
+	// A browser player and a TCP player in the same session.
+	web := dialTestWebSocket(t, l.Addr().String(), "browser")
+	tcp := dialTestClient(t, addr, "native")
+	if web.mapName != "test" || len(web.lvl.world) != 8 {
+		t.Fatalf("unexpected welcome: %q", web.mapName)
+	}
+
+	g := &Game{width: 64, height: 48}
+	g.joinServer(web)
+	if err := g.updateNet(actForward); err != nil {
+		t.Fatalf("updateNet: %s", err)
+	}
+	waitFor(t, "the browser player to move", func() bool {
+		_, players, _ := tcp.state()
+		for _, p := range players {
+			if p.Name == "browser" && p.Pos.X > 4 {
+				return true
+			}
+		}
+		return false
+	})
+}
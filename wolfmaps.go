@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+// Original Wolfenstein 3D map files.
+//
+// MAPHEAD holds the RLEW tag followed by the offsets of each map header in GAMEMAPS.
+// Each map header has the offsets and lengths of the 3 planes, the map size and name.
+// Planes are RLEW compressed, then Carmack compressed.
+//
+// Ref: https://moddingwiki.shikadi.net/wiki/GameMaps_Format
+const (
+	wolfMaxMaps  = 100
+	wolfNumPlane = 3
+
+	// Carmack pointer tags.
+	carmackNearTag = 0xa7
+	carmackFarTag  = 0xa8
+)
+
+// wolfMap is a decompressed map from GAMEMAPS.
+type wolfMap struct {
+	name          string
+	width, height int
+	planes        [wolfNumPlane][]uint16 // 0: walls, 1: objects, 2: unused.
+}
+
+// cmdImportWolf3D lists the maps from the given MAPHEAD/GAMEMAPS files
+// or prints the one at the given index in our format.
+func cmdImportWolf3D(args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errors.New("usage: import-wolf3d <MAPHEAD> <GAMEMAPS> [index]")
+	}
+	maphead, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("readFile maphead: %w", err)
+	}
+	gamemaps, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("readFile gamemaps: %w", err)
+	}
+	maps, err := loadWolfMaps(maphead, gamemaps)
+	if err != nil {
+		return fmt.Errorf("loadWolfMaps: %w", err)
+	}
+
+	if len(args) == 2 {
+		for i, m := range maps {
+			fmt.Printf("%d: %s (%dx%d)\n", i, m.name, m.width, m.height)
+		}
+		return nil
+	}
+
+	i, err := strconv.Atoi(args[2])
+	if err != nil || i < 0 || i >= len(maps) {
+		return fmt.Errorf("invalid map index %q, expected 0 to %d", args[2], len(maps)-1)
+	}
+	fmt.Printf("# %s\n", maps[i].name)
+	_, err = os.Stdout.Write(formatLevel(maps[i].level()))
+	return err
+}
+
+// loadWolfMaps decodes all the maps referenced by MAPHEAD from GAMEMAPS.
+func loadWolfMaps(maphead, gamemaps []byte) ([]*wolfMap, error) {
+	if len(maphead) < 2 {
+		return nil, errors.New("maphead too short")
+	}
+	rlewTag := binary.LittleEndian.Uint16(maphead)
+
+	var out []*wolfMap
+	for i := 0; i < wolfMaxMaps && 2+(i+1)*4 <= len(maphead); i++ {
+		offset := binary.LittleEndian.Uint32(maphead[2+i*4:])
+		if offset == 0 || offset == 0xffffffff {
+			continue
+		}
+		m, err := loadWolfMap(gamemaps, int(offset), rlewTag)
+		if err != nil {
+			return nil, fmt.Errorf("map %d: %w", i, err)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func loadWolfMap(gamemaps []byte, offset int, rlewTag uint16) (*wolfMap, error) {
+	// 3 int32 plane offsets, 3 uint16 plane lengths, uint16 width/height, 16 bytes name.
+	const headerSize = wolfNumPlane*4 + wolfNumPlane*2 + 2 + 2 + 16
+	if offset+headerSize > len(gamemaps) {
+		return nil, fmt.Errorf("header out of bounds")
+	}
+	hdr := gamemaps[offset : offset+headerSize]
+
+	m := &wolfMap{
+		width:  int(binary.LittleEndian.Uint16(hdr[18:])),
+		height: int(binary.LittleEndian.Uint16(hdr[20:])),
+		name:   strings.TrimRight(string(hdr[22:38]), "\x00"),
+	}
+	for i := 0; i < wolfNumPlane; i++ {
+		start := int(binary.LittleEndian.Uint32(hdr[i*4:]))
+		length := int(binary.LittleEndian.Uint16(hdr[12+i*2:]))
+		if length == 0 {
+			continue
+		}
+		if start+length > len(gamemaps) {
+			return nil, fmt.Errorf("plane %d out of bounds", i)
+		}
+		rlew, err := carmackDecompress(gamemaps[start : start+length])
+		if err != nil {
+			return nil, fmt.Errorf("plane %d: carmack: %w", i, err)
+		}
+		plane, err := rlewDecompress(rlew, rlewTag)
+		if err != nil {
+			return nil, fmt.Errorf("plane %d: rlew: %w", i, err)
+		}
+		if len(plane) < m.width*m.height {
+			return nil, fmt.Errorf("plane %d: got %d tiles, expected %d", i, len(plane), m.width*m.height)
+		}
+		m.planes[i] = plane
+	}
+	if m.planes[0] == nil {
+		return nil, errors.New("missing wall plane")
+	}
+	return m, nil
+}
+
+// carmackDecompress decodes the Carmack compression.
+//
+// The data starts with the decompressed size in bytes, then words.
+// A word with 0xa7 (near) or 0xa8 (far) as high byte is a pointer,
+// with the low byte being the count of words to copy:
+//   - near: the next byte is the distance in words back from the current position,
+//   - far: the next word is the absolute position in words.
+//
+// A count of 0 escapes the tag: the next byte is the high byte of a literal word.
+func carmackDecompress(in []byte) ([]byte, error) {
+	if len(in) < 2 {
+		return nil, errors.New("missing size")
+	}
+	size := int(binary.LittleEndian.Uint16(in)) / 2
+	in = in[2:]
+
+	out := make([]uint16, 0, size)
+	for len(out) < size {
+		if len(in) < 2 {
+			return nil, errors.New("unexpected end of data")
+		}
+		w := binary.LittleEndian.Uint16(in)
+		count, tag := int(w&0xff), w>>8
+		in = in[2:]
+
+		if tag != carmackNearTag && tag != carmackFarTag {
+			out = append(out, w)
+			continue
+		}
+		if len(in) < 1 {
+			return nil, errors.New("unexpected end of data")
+		}
+		if count == 0 {
+			out = append(out, tag<<8|uint16(in[0]))
+			in = in[1:]
+			continue
+		}
+
+		var from int
+		if tag == carmackNearTag {
+			from = len(out) - int(in[0])
+			in = in[1:]
+		} else {
+			if len(in) < 2 {
+				return nil, errors.New("unexpected end of data")
+			}
+			from = int(binary.LittleEndian.Uint16(in))
+			in = in[2:]
+		}
+		if from < 0 || from >= len(out) {
+			return nil, fmt.Errorf("invalid pointer to %d at %d", from, len(out))
+		}
+		// Copy word by word, the source can overlap the destination.
+		for i := 0; i < count; i++ {
+			out = append(out, out[from+i])
+		}
+	}
+
+	buf := make([]byte, len(out)*2)
+	for i, w := range out {
+		binary.LittleEndian.PutUint16(buf[i*2:], w)
+	}
+	return buf, nil
+}
+
+// rlewDecompress decodes the RLEW compression.
+//
+// The data starts with the decompressed size in bytes, then words.
+// A word equal to the tag is followed by the count and the value to repeat.
+func rlewDecompress(in []byte, tag uint16) ([]uint16, error) {
+	if len(in) < 2 {
+		return nil, errors.New("missing size")
+	}
+	size := int(binary.LittleEndian.Uint16(in)) / 2
+	r := bytes.NewReader(in[2:])
+
+	out := make([]uint16, 0, size)
+	for len(out) < size {
+		var w uint16
+		if err := binary.Read(r, binary.LittleEndian, &w); err != nil {
+			return nil, fmt.Errorf("read: %w", err)
+		}
+		if w != tag {
+			out = append(out, w)
+			continue
+		}
+		var run [2]uint16 // Count, value.
+		if err := binary.Read(r, binary.LittleEndian, &run); err != nil {
+			return nil, fmt.Errorf("read run: %w", err)
+		}
+		for i := 0; i < int(run[0]); i++ {
+			out = append(out, run[1])
+		}
+	}
+	return out[:size], nil
+}
+
+// level converts the map to our format.
+//
+// Walls (1-63) are mapped on our 7 textures,
+// doors (90-101) become walkable bars as there are no doors (yet),
+// area codes (106+) are empty cases.
+// The player start (19-22) sets the spawn, other objects are kept as "wolf3d:<id>".
+func (m *wolfMap) level() *level {
+	lvl := &level{
+		world: make([][]MapPoint, m.height),
+		spawn: math2.Pt(float64(m.width/2), float64(m.height)/2),
+	}
+	for y := 0; y < m.height; y++ {
+		lvl.world[y] = make([]MapPoint, m.width)
+		for x := 0; x < m.width; x++ {
+			lvl.world[y][x] = MapPoint{Point: math2.Pt(x, y), wallType: wolfWallType(m.planes[0][y*m.width+x])}
+		}
+	}
+
+	if m.planes[1] == nil {
+		return lvl
+	}
+	for i, id := range m.planes[1][:m.width*m.height] {
+		pos := math2.Pt(float64(i%m.width)+0.5, float64(i/m.width)+0.5)
+		switch {
+		case id == 0: // Nothing.
+		case id >= 19 && id <= 22: // North, east, south, west.
+			lvl.spawn = pos
+			lvl.spawnDir = math2.NewDegAngle(int(id-20) * 90)
+		default:
+			lvl.objects = append(lvl.objects, levelObject{kind: fmt.Sprintf("wolf3d:%d", id), pos: pos})
+		}
+	}
+	return lvl
+}
+
+func wolfWallType(tile uint16) int {
+	switch {
+	case tile >= 1 && tile <= 63:
+		return int(tile-1)%7 + 1
+	case tile >= 90 && tile <= 101:
+		return wallBars | wallPassable
+	case tile == 0 || tile >= 106:
+		return 0
+	default:
+		// Unknown tiles, keep the map closed.
+		return 1
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"go.creack.net/wolf3d/math2"
+)
+
+const testRLEWTag = 0xabcd
+
+func words(ws ...uint16) []byte {
+	buf := make([]byte, len(ws)*2)
+	for i, w := range ws {
+		binary.LittleEndian.PutUint16(buf[i*2:], w)
+	}
+	return buf
+}
+
+// rlewCompress encodes runs of 4 or more words as well as the tag itself.
+func rlewCompress(in []uint16) []byte {
+	out := []uint16{uint16(len(in) * 2)}
+	for i := 0; i < len(in); {
+		j := i
+		for j < len(in) && in[j] == in[i] {
+			j++
+		}
+		if j-i >= 4 || in[i] == testRLEWTag {
+			out = append(out, testRLEWTag, uint16(j-i), in[i])
+		} else {
+			out = append(out, in[i:j]...)
+		}
+		i = j
+	}
+	return words(out...)
+}
+
+// carmackCompress encodes the data as literals.
+// A word with a near/far tag as high byte is escaped as a 0 count, the tag, then the low byte.
+func carmackCompress(in []byte) []byte {
+	out := words(uint16(len(in)))
+	for i := 0; i+1 < len(in); i += 2 {
+		if lo, hi := in[i], in[i+1]; hi == carmackNearTag || hi == carmackFarTag {
+			out = append(out, 0, hi, lo)
+			continue
+		}
+		out = append(out, in[i], in[i+1])
+	}
+	return out
+}
+
+func TestCarmackDecompress(t *testing.T) {
+	t.Parallel()
+
+	in := words(7*2, 0x0001, 0x0002)
+	in = append(in, 0x02, carmackNearTag, 2)   // Copy 2 words from 2 words back.
+	in = append(in, 0x00, carmackFarTag, 0x42) // Escaped 0xa842 literal.
+	in = append(in, 0x02, carmackFarTag, 1, 0) // Copy 2 words from word 1.
+	out, err := carmackDecompress(in)
+	if err != nil {
+		t.Fatalf("carmackDecompress: %s", err)
+	}
+	if expect, got := words(1, 2, 1, 2, 0xa842, 2, 1), out; !bytes.Equal(expect, got) {
+		t.Fatalf("unexpected output:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+
+	// Escaped words round trip.
+	tagged := words(0xa700, 0xa8ff, 0x00a7)
+	if out, err := carmackDecompress(carmackCompress(tagged)); err != nil || !bytes.Equal(tagged, out) {
+		t.Fatalf("unexpected round trip:\nexpect:\t%v\ngot:\t%v (%v)", tagged, out, err)
+	}
+
+	if _, err := carmackDecompress(words(4, 0x01a7)); err == nil {
+		t.Fatal("truncated pointer should fail")
+	}
+	if _, err := carmackDecompress(append(words(4, 1), 0x01, carmackNearTag, 3)); err == nil {
+		t.Fatal("out of bounds pointer should fail")
+	}
+}
+
+func TestRLEWDecompress(t *testing.T) {
+	t.Parallel()
+
+	out, err := rlewDecompress(words(6*2, 1, testRLEWTag, 4, 7, 2), testRLEWTag)
+	if err != nil {
+		t.Fatalf("rlewDecompress: %s", err)
+	}
+	if expect, got := []uint16{1, 7, 7, 7, 7, 2}, out; !bytes.Equal(words(expect...), words(got...)) {
+		t.Fatalf("unexpected output:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+}
+
+func TestLoadWolfMaps(t *testing.T) {
+	t.Parallel()
+
+	const size = 64
+
+	// Walls all around, a door and area codes inside.
+	walls := make([]uint16, size*size)
+	objects := make([]uint16, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			switch {
+			case x == 0 || y == 0 || x == size-1 || y == size-1:
+				walls[y*size+x] = 1 + uint16(x%10)
+			case x == 10 && y == 10:
+				walls[y*size+x] = 90
+			default:
+				walls[y*size+x] = 107
+			}
+		}
+	}
+	objects[20*size+5] = 21 // Player facing south.
+	objects[30*size+40] = 23
+
+	// GAMEMAPS: signature, planes, then the map header.
+	gamemaps := []byte("TED5v1.0")
+	var planes [wolfNumPlane][2]int // Offset, length.
+	for i, plane := range [][]uint16{walls, objects, make([]uint16, size*size)} {
+		data := carmackCompress(rlewCompress(plane))
+		planes[i] = [2]int{len(gamemaps), len(data)}
+		gamemaps = append(gamemaps, data...)
+	}
+	headerOffset := len(gamemaps)
+	for _, p := range planes {
+		gamemaps = binary.LittleEndian.AppendUint32(gamemaps, uint32(p[0]))
+	}
+	for _, p := range planes {
+		gamemaps = binary.LittleEndian.AppendUint16(gamemaps, uint16(p[1]))
+	}
+	gamemaps = binary.LittleEndian.AppendUint16(gamemaps, size)
+	gamemaps = binary.LittleEndian.AppendUint16(gamemaps, size)
+	name := make([]byte, 16)
+	copy(name, "Wolf1 Map1")
+	gamemaps = append(gamemaps, name...)
+
+	// MAPHEAD: tag, then the first map offset, the others being empty.
+	maphead := words(testRLEWTag)
+	maphead = binary.LittleEndian.AppendUint32(maphead, uint32(headerOffset))
+	maphead = append(maphead, make([]byte, (wolfMaxMaps-1)*4)...)
+
+	maps, err := loadWolfMaps(maphead, gamemaps)
+	if err != nil {
+		t.Fatalf("loadWolfMaps: %s", err)
+	}
+	if len(maps) != 1 {
+		t.Fatalf("unexpected map count: %d", len(maps))
+	}
+	m := maps[0]
+	if m.name != "Wolf1 Map1" || m.width != size || m.height != size {
+		t.Fatalf("unexpected map header: %q %dx%d", m.name, m.width, m.height)
+	}
+
+	lvl := m.level()
+	for _, tc := range []struct {
+		x, y     int
+		wallType int
+	}{
+		{0, 0, 1},
+		{7, 0, 1},
+		{8, 0, 2},
+		{10, 10, wallBars | wallPassable},
+		{20, 20, 0},
+	} {
+		if got := lvl.world[tc.y][tc.x].wallType; got != tc.wallType {
+			t.Errorf("unexpected wall type at %d/%d:\nexpect:\t%#x\ngot:\t%#x", tc.x, tc.y, tc.wallType, got)
+		}
+	}
+	if expect, got := math2.Pt(5.5, 20.5), lvl.spawn; expect != got {
+		t.Errorf("unexpected spawn:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if expect, got := 90., lvl.spawnDir.Degrees(); expect != got {
+		t.Errorf("unexpected spawn direction:\nexpect:\t%v\ngot:\t%v", expect, got)
+	}
+	if len(lvl.objects) != 1 || lvl.objects[0].kind != "wolf3d:23" || lvl.objects[0].pos != math2.Pt(40.5, 30.5) {
+		t.Errorf("unexpected objects: %+v", lvl.objects)
+	}
+
+	// The imported level should be valid and survive a round trip in our format.
+	buf := formatLevel(lvl)
+	for _, issue := range validateMap(buf) {
+		t.Errorf("invalid level: %s", issue)
+	}
+	lvl2, err := parseLevel(buf)
+	if err != nil {
+		t.Fatalf("parseLevel: %s", err)
+	}
+	if !bytes.Equal(buf, formatLevel(lvl2)) {
+		t.Errorf("round trip mismatch")
+	}
+}